@@ -0,0 +1,256 @@
+//Package bot classifies requests from crawlers, link unfurlers, and link scanners
+package bot
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//Signatures are lowercase User-Agent substrings of known crawlers, chat and email link unfurlers,
+//link scanners, and HTTP libraries
+var Signatures = []string{
+	//chat and social unfurlers
+	"slackbot",
+	"slack-imgproxy",
+	"skypeuripreview",
+	"microsoftpreview",
+	"teamsbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"twitterbot",
+	"facebookexternalhit",
+	"facebookcatalog",
+	"facebot",
+	"linkedinbot",
+	"pinterest",
+	"redditbot",
+	"tumblr",
+	"vkshare",
+	"snapchat",
+	"mattermost",
+	"rocket.chat",
+	"xing-contenttabreceiver",
+	"embedly",
+	"iframely",
+	"bitlybot",
+	"google-pagerenderer",
+	"googleimageproxy",
+
+	//search engines and crawlers
+	"googlebot",
+	"googleother",
+	"google-inspectiontool",
+	"adsbot-google",
+	"mediapartners-google",
+	"feedfetcher-google",
+	"apis-google",
+	"bingbot",
+	"bingpreview",
+	"msnbot",
+	"applebot",
+	"duckduckbot",
+	"baiduspider",
+	"yandex",
+	"sogou",
+	"ia_archiver",
+	"ahrefsbot",
+	"semrushbot",
+	"mj12bot",
+	"dotbot",
+	"petalbot",
+	"bytespider",
+	"ccbot",
+	"gptbot",
+
+	//email link scanners
+	"proofpoint",
+	"mimecast",
+	"barracuda",
+
+	//headless browsers and HTTP libraries
+	"headlesschrome",
+	"phantomjs",
+	"curl/",
+	"wget/",
+	"python-requests/",
+	"python-urllib/",
+	"aiohttp/",
+	"go-http-client/",
+	"java/",
+	"okhttp/",
+	"apache-httpclient/",
+	"libwww-perl/",
+	"axios/",
+	"node-fetch/",
+
+	//generic markers
+	"bot/",
+	"bot;",
+	"crawler",
+	"spider",
+	"preview",
+}
+
+//Unfurlers are lowercase User-Agent substrings of chat and social apps that show previews of shared links
+var Unfurlers = []string{
+	"slackbot",
+	"skypeuripreview",
+	"microsoftpreview",
+	"teamsbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"twitterbot",
+	"facebookexternalhit",
+	"facebot",
+	"linkedinbot",
+	"pinterest",
+	"redditbot",
+	"vkshare",
+	"snapchat",
+	"mattermost",
+	"rocket.chat",
+	"xing-contenttabreceiver",
+	"embedly",
+	"iframely",
+	"google-pagerenderer",
+}
+
+//IsUnfurler returns true if userAgent belongs to a link unfurler
+func IsUnfurler(userAgent string) bool {
+	ua := strings.ToLower(userAgent)
+	for _, u := range Unfurlers {
+		if strings.Contains(ua, u) {
+			return true
+		}
+	}
+	return false
+}
+
+//Classifier matches requests against User-Agent signatures and IP networks
+type Classifier struct {
+	agents   []string
+	networks []*net.IPNet
+}
+
+//New returns a new *Classifier that matches Signatures and the given additional User-Agent substrings,
+//and the given networks in CIDR notation or single IP addresses, or an error if a network is invalid
+func New(agents, networks []string) (*Classifier, error) {
+	c := &Classifier{agents: make([]string, 0, len(Signatures)+len(agents))}
+	for _, a := range append(append([]string{}, Signatures...), agents...) {
+		if a = strings.ToLower(strings.TrimSpace(a)); a != "" {
+			c.agents = append(c.agents, a)
+		}
+	}
+
+	var err error
+	if c.networks, err = ParseNetworks(networks); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//ParseNetworks parses networks in CIDR notation or single IP addresses, skipping blank entries,
+//or returns an error if a network is invalid
+func ParseNetworks(networks []string) ([]*net.IPNet, error) {
+	var parsed []*net.IPNet
+	for _, n := range networks {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address: %s", n)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid network %s: %v", n, err)
+		}
+		parsed = append(parsed, network)
+	}
+
+	return parsed, nil
+}
+
+//contains returns true if ip is in one of networks
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//ClientIP returns the client address of a request from remoteAddr (an IP address with an optional port)
+//with the given X-Forwarded-For header values. X-Forwarded-For is read from right to left only while
+//the address that added each entry is one of proxies, so clients can't choose the address by sending the header
+func ClientIP(remoteAddr string, forwardedFor []string, proxies []*net.IPNet) string {
+	addr := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		addr = h
+	}
+
+	var hops []string
+	for _, h := range forwardedFor {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(addr)
+		if ip == nil || !contains(proxies, ip) {
+			break
+		}
+
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		addr = hop
+	}
+
+	return addr
+}
+
+//Match returns true if userAgent or remoteAddr (an IP address with an optional port) belong to a bot.
+//Requests without a User-Agent are considered bots
+func (c *Classifier) Match(userAgent, remoteAddr string) bool {
+	if strings.TrimSpace(userAgent) == "" {
+		return true
+	}
+
+	ua := strings.ToLower(userAgent)
+	for _, a := range c.agents {
+		if strings.Contains(ua, a) {
+			return true
+		}
+	}
+
+	if len(c.networks) == 0 {
+		return false
+	}
+
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	return contains(c.networks, ip)
+}
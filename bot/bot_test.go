@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"net"
+	"testing"
+)
+
+const browser = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks []string
+		ok       bool
+		count    int
+	}{
+		{"none", nil, true, 0},
+		{"blank entries", []string{"", "  "}, true, 0},
+		{"IPv4 CIDR", []string{"10.0.0.0/8"}, true, 1},
+		{"IPv6 CIDR", []string{"2001:db8::/32"}, true, 1},
+		{"single IPv4", []string{" 192.0.2.5 "}, true, 1},
+		{"single IPv6", []string{"2001:db8::1"}, true, 1},
+		{"mixed", []string{"10.0.0.0/8", "192.0.2.5", "2001:db8::/32"}, true, 3},
+		{"invalid IP", []string{"192.0.2"}, false, 0},
+		{"hostname", []string{"crawler.example.com"}, false, 0},
+		{"invalid CIDR", []string{"10.0.0.0/33"}, false, 0},
+		{"invalid CIDR address", []string{"10.0.0/8"}, false, 0},
+	}
+
+	for _, test := range tests {
+		c, err := New(nil, test.networks)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %t, got %v", test.name, test.ok, err)
+			continue
+		}
+		if err == nil && len(c.networks) != test.count {
+			t.Errorf("%s: expected %d networks, got %d", test.name, test.count, len(c.networks))
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c, err := New([]string{" Monitor-Agent ", ""}, []string{"10.0.0.0/8", "192.0.2.5", "2001:db8::/32", "2001:db8:ffff::1"})
+	if err != nil {
+		t.Fatalf("Unable to create classifier: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		remoteAddr string
+		want       bool
+	}{
+		{"empty User-Agent", "", "198.51.100.1:1234", true},
+		{"blank User-Agent", "   ", "198.51.100.1:1234", true},
+		{"browser", browser, "198.51.100.1:1234", false},
+		{"signature", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", "198.51.100.1:1234", true},
+		{"signature case", "CURL/8.0", "198.51.100.1:1234", true},
+		{"generic marker", "Mozilla/5.0 (compatible; ExampleBot/1.0)", "198.51.100.1:1234", true},
+		{"additional agent", "monitor-agent/2", "198.51.100.1:1234", true},
+		{"CIDR", browser, "10.1.2.3:1234", true},
+		{"CIDR without port", browser, "10.1.2.3", true},
+		{"outside CIDR", browser, "11.1.2.3:1234", false},
+		{"single IP", browser, "192.0.2.5:1234", true},
+		{"next to single IP", browser, "192.0.2.6:1234", false},
+		{"IPv6 CIDR", browser, "[2001:db8:1::1]:1234", true},
+		{"single IPv6", browser, "[2001:db8:ffff::1]:1234", true},
+		{"outside IPv6 CIDR", browser, "[2001:db9::1]:1234", false},
+		{"IPv4-mapped IPv6", browser, "[::ffff:10.1.2.3]:1234", true},
+		{"invalid address", browser, "not-an-ip", false},
+		{"empty address", browser, "", false},
+	}
+
+	for _, test := range tests {
+		if got := c.Match(test.userAgent, test.remoteAddr); got != test.want {
+			t.Errorf("%s: expected Match(%q, %q) to be %t", test.name, test.userAgent, test.remoteAddr, test.want)
+		}
+	}
+
+	//the empty User-Agent rule doesn't depend on networks
+	c, err = New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Match("", "") || c.Match(browser, "10.1.2.3:1234") {
+		t.Error("Expected classifier without networks to only match the empty User-Agent")
+	}
+}
+
+func TestIsUnfurler(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", true},
+		{"facebookexternalhit/1.1", true},
+		{"Googlebot/2.1 (+http://www.google.com/bot.html)", false},
+		{"curl/8.0", false},
+		{browser, false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := IsUnfurler(test.userAgent); got != test.want {
+			t.Errorf("Expected IsUnfurler(%q) to be %t", test.userAgent, test.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseNetworks([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("Unable to parse proxies: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		proxies      []*net.IPNet
+		want         string
+	}{
+		{"direct", "198.51.100.1:1234", nil, proxies, "198.51.100.1"},
+		{"no port", "198.51.100.1", nil, proxies, "198.51.100.1"},
+		{"untrusted header ignored", "198.51.100.1:1234", []string{"192.0.2.5"}, proxies, "198.51.100.1"},
+		{"no proxies", "10.0.0.1:1234", []string{"192.0.2.5"}, nil, "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"192.0.2.5"}, proxies, "192.0.2.5"},
+		{"trusted IPv6 proxy", "[2001:db8::1]:1234", []string{"192.0.2.5"}, proxies, "192.0.2.5"},
+		{"proxy without header", "10.0.0.1:1234", nil, proxies, "10.0.0.1"},
+		{"spoofed entry before client", "10.0.0.1:1234", []string{"10.9.9.9, 192.0.2.5"}, proxies, "192.0.2.5"},
+		{"chained proxies", "10.0.0.1:1234", []string{"192.0.2.5, 10.0.0.2"}, proxies, "192.0.2.5"},
+		{"multiple headers", "10.0.0.1:1234", []string{"192.0.2.5", "10.0.0.2"}, proxies, "192.0.2.5"},
+		{"all proxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, proxies, "10.0.0.3"},
+		{"invalid entry", "10.0.0.1:1234", []string{"192.0.2.5, unknown"}, proxies, "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		if got := ClientIP(test.remoteAddr, test.forwardedFor, test.proxies); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
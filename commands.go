@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+	"github.com/korylprince/url-shortener-server/v2/importer"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s [command]
+
+Commands:
+  serve                                   run the HTTP server (default)
+  urls list [-user <user>] [-json]        list URLs
+  urls get <id>                           show a URL
+  urls create [-id <id>] [-expires <RFC3339 time>] <user> <url>
+                                          create a URL
+  urls delete <id>                        delete a URL
+  urls restore <id>                       restore a deleted URL
+  urls transfer <id> <user>               change the owner of a URL
+  users list                              list users that own URLs
+  db check [-repair] [-json]              check database file and record consistency
+  db collisions [-json]                   list URLs with IDs or aliases that are the same ignoring case
+  db compact                              compact the database file
+  db backup <path>                        write a consistent copy of the database to path
+  export [<path>]                         export URLs as JSON to path or stdout
+  import -format <format> <file>          import URLs; see import -h
+
+Commands read the same SHORTENER_* environment configuration as the server, except for the LDAP options.
+The database can only be opened by one process, so stop the server before running commands.
+`, os.Args[0])
+}
+
+//cliUser returns the user recorded as making changes with commands: "cli:" and the OS user, or "cli" if it's unknown
+func cliUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+func openDB(config *Config) *bbolt.DB {
+	d, err := bbolt.New(config.DatabasePath, config.URLIDLength)
+	if err != nil {
+		log.Fatalln("Unable to open database:", err)
+	}
+	d.SetGenerator(config.Generator(), config.IDMaxAttempts)
+	if config.CaseInsensitiveIDs {
+		d.CaseInsensitiveIDs()
+	}
+	return d
+}
+
+func printJSON(v interface{}) {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(v); err != nil {
+		log.Fatalln("Unable to write JSON:", err)
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func printURLs(urls []*db.URL) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tVIEWS\tEXPIRES\tCREATED\tMODIFIED\tURL")
+	for _, u := range urls {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", u.ID, u.User, u.Views, formatTime(u.Expires), formatTime(u.Created), formatTime(u.LastModified), u.URL)
+	}
+	w.Flush()
+}
+
+func requireArgs(flags *flag.FlagSet, n int, usage string) {
+	if flags.NArg() != n {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], usage)
+		os.Exit(2)
+	}
+}
+
+func urlsCommand(config *Config, args []string) {
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("urls "+args[0], flag.ExitOnError)
+
+	switch args[0] {
+	case "list":
+		user := flags.String("user", "", "only list URLs owned by user")
+		asJSON := flags.Bool("json", false, "output JSON")
+		flags.Parse(args[1:])
+		requireArgs(flags, 0, "urls list [-user <user>] [-json]")
+
+		d := openDB(config)
+		defer d.Close()
+
+		urls, err := d.URLs(*user)
+		if err != nil {
+			log.Fatalln("Unable to list URLs:", err)
+		}
+		sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+
+		if *asJSON {
+			printJSON(urls)
+			return
+		}
+		printURLs(urls)
+	case "get":
+		flags.Parse(args[1:])
+		requireArgs(flags, 1, "urls get <id>")
+
+		d := openDB(config)
+		defer d.Close()
+
+		url, err := d.Get(flags.Arg(0))
+		if err != nil {
+			log.Fatalln("Unable to get URL:", err)
+		}
+		if url == nil {
+			log.Fatalf("URL %s does not exist\n", flags.Arg(0))
+		}
+		printJSON(url)
+	case "create":
+		id := flags.String("id", "", "custom URL ID; random if empty")
+		expires := flags.String("expires", "", "expiration time in RFC3339 format")
+		flags.Parse(args[1:])
+		requireArgs(flags, 2, "urls create [-id <id>] [-expires <RFC3339 time>] <user> <url>")
+
+		url := &db.URL{ID: *id, URL: flags.Arg(1)}
+		if config.CaseInsensitiveIDs {
+			url.ID = strings.ToLower(url.ID)
+		}
+		if err := db.ValidateURL(url); err != nil {
+			log.Fatalln("Invalid URL:", err)
+		}
+		if *expires != "" {
+			t, err := time.Parse(time.RFC3339, *expires)
+			if err != nil {
+				log.Fatalln("Unable to parse expiration time:", err)
+			}
+			url.Expires = &t
+		}
+
+		d := openDB(config)
+		defer d.Close()
+
+		newID, err := d.Put(url, flags.Arg(0))
+		if err != nil {
+			log.Fatalln("Unable to create URL:", err)
+		}
+		fmt.Println(newID)
+	case "delete", "restore":
+		flags.Parse(args[1:])
+		requireArgs(flags, 1, fmt.Sprintf("urls %s <id>", args[0]))
+
+		d := openDB(config)
+		defer d.Close()
+
+		var err error
+		if args[0] == "delete" {
+			var url *db.URL
+			if url, err = d.Get(flags.Arg(0)); err == nil && url == nil {
+				log.Fatalf("URL %s does not exist\n", flags.Arg(0))
+			}
+			if err == nil {
+				err = d.Delete(url.ID, cliUser())
+			}
+		} else {
+			err = d.Restore(flags.Arg(0), cliUser())
+		}
+		if err != nil {
+			log.Fatalf("Unable to %s URL: %v\n", args[0], err)
+		}
+	case "transfer":
+		flags.Parse(args[1:])
+		requireArgs(flags, 2, "urls transfer <id> <user>")
+
+		d := openDB(config)
+		defer d.Close()
+
+		if err := d.Transfer(flags.Arg(0), flags.Arg(1), cliUser()); err != nil {
+			log.Fatalln("Unable to transfer URL:", err)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usersCommand(config *Config, args []string) {
+	if len(args) != 1 || args[0] != "list" {
+		usage()
+		os.Exit(2)
+	}
+
+	d := openDB(config)
+	defer d.Close()
+
+	users, err := d.Users()
+	if err != nil {
+		log.Fatalln("Unable to list users:", err)
+	}
+	sort.Strings(users)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tURLS")
+	for _, user := range users {
+		urls, err := d.URLs(user)
+		if err != nil {
+			log.Fatalf("Unable to list URLs for user %s: %v\n", user, err)
+		}
+		fmt.Fprintf(w, "%s\t%d\n", user, len(urls))
+	}
+	w.Flush()
+}
+
+func dbCommand(config *Config, args []string) {
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("db "+args[0], flag.ExitOnError)
+
+	switch args[0] {
+	case "check":
+		repair := flags.Bool("repair", false, "repair problems with URL records and the users index where possible")
+		asJSON := flags.Bool("json", false, "output JSON")
+		flags.Parse(args[1:])
+		requireArgs(flags, 0, "db check [-repair] [-json]")
+
+		d := openDB(config)
+		defer d.Close()
+
+		errs, err := d.Check()
+		if err != nil {
+			log.Fatalln("Unable to check database:", err)
+		}
+		for _, err := range errs {
+			fmt.Println("Database file error:", err)
+		}
+		if len(errs) > 0 {
+			d.Close()
+			log.Fatalf("Found %d database file errors; restore from a backup\n", len(errs))
+		}
+
+		report, err := d.CheckRecords(*repair)
+		if err != nil {
+			log.Fatalln("Unable to check records:", err)
+		}
+
+		if *asJSON {
+			printJSON(report)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TYPE\tID\tUSER\tREPAIRED\tERROR")
+			for _, p := range report.Problems {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", p.Type, p.ID, p.User, p.Repaired, p.Error)
+			}
+			w.Flush()
+			fmt.Printf("Checked %d URLs and %d users: %d problems found\n", report.URLs, report.Users, len(report.Problems))
+		}
+
+		for _, p := range report.Problems {
+			if !p.Repaired {
+				d.Close()
+				os.Exit(1)
+			}
+		}
+	case "collisions":
+		asJSON := flags.Bool("json", false, "output JSON")
+		flags.Parse(args[1:])
+		requireArgs(flags, 0, "db collisions [-json]")
+
+		d := openDB(config)
+		defer d.Close()
+
+		collisions, err := d.Collisions()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if *asJSON {
+			printJSON(collisions)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tURLS")
+			for _, c := range collisions {
+				fmt.Fprintf(w, "%s\t%s\n", c.ID, strings.Join(c.URLs, ","))
+			}
+			w.Flush()
+			fmt.Printf("%d IDs are used by more than one URL ignoring case\n", len(collisions))
+		}
+
+		if len(collisions) > 0 {
+			d.Close()
+			os.Exit(1)
+		}
+	case "compact":
+		flags.Parse(args[1:])
+		requireArgs(flags, 0, "db compact")
+
+		d := openDB(config)
+		tmp := config.DatabasePath + ".compact"
+		if err := d.Compact(tmp); err != nil {
+			d.Close()
+			log.Fatalln(err)
+		}
+		if err := d.Close(); err != nil {
+			log.Fatalln("Unable to close database:", err)
+		}
+
+		before, err := os.Stat(config.DatabasePath)
+		if err != nil {
+			log.Fatalln("Unable to stat database:", err)
+		}
+		after, err := os.Stat(tmp)
+		if err != nil {
+			log.Fatalln("Unable to stat compacted database:", err)
+		}
+
+		if err = os.Rename(tmp, config.DatabasePath); err != nil {
+			log.Fatalln("Unable to replace database with compacted database:", err)
+		}
+		fmt.Printf("Compacted %d bytes to %d bytes\n", before.Size(), after.Size())
+	case "backup":
+		flags.Parse(args[1:])
+		requireArgs(flags, 1, "db backup <path>")
+
+		f, err := os.OpenFile(flags.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			log.Fatalln("Unable to create backup file:", err)
+		}
+
+		d := openDB(config)
+		defer d.Close()
+
+		n, err := d.Backup(f)
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			log.Fatalln("Unable to backup database:", err)
+		}
+		fmt.Printf("Wrote %d bytes to %s\n", n, flags.Arg(0))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func exportCommand(config *Config, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s export [<path>]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	out := os.Stdout
+	if flags.NArg() == 1 {
+		f, err := os.OpenFile(flags.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			log.Fatalln("Unable to create export file:", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	d := openDB(config)
+	defer d.Close()
+
+	if err := importer.Export(d, out); err != nil {
+		log.Fatalln("Unable to export URLs:", err)
+	}
+}
@@ -2,9 +2,17 @@ package main
 
 import (
 	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 
+	"github.com/kelseyhightower/envconfig"
 	auth "github.com/korylprince/go-ad-auth/v3"
+	"github.com/korylprince/url-shortener-server/v2/bot"
+	"github.com/korylprince/url-shortener-server/v2/idgen"
+	"github.com/korylprince/url-shortener-server/v2/logger"
 )
 
 //Config represents options given in the environment
@@ -13,22 +21,192 @@ type Config struct {
 
 	DatabasePath string `required:"true"`
 
-	URLIDLength int `default:"6" required:"true"`
+	URLIDLength   int    `default:"6" required:"true"`
+	IDStrategy    string `default:"random"` //random, unambiguous, lowercase, words, or sequential
+	IDMaxAttempts int    `default:"50"`     //number of generated IDs to try before giving up
+
+	CaseInsensitiveIDs bool `default:"false"` //lowercase custom IDs and match IDs ignoring case
 
 	AppTitle string
 
+	YOURLSAPI bool `default:"false"` //enable YOURLS-compatible API at /yourls-api.php
+
+	ViewDurability    string `default:"sync"` //sync or batch
+	ViewFlushInterval int    `default:"10"`   //in seconds; used with batch ViewDurability
+
+	CacheSize int `default:"10000"` //number of resolved URLs to cache; 0 disables the cache
+	CacheTTL  int `default:"300"`   //in seconds
+
+	LDAPConfig `ignored:"true"` //read by serve with ProcessLDAP
+
+	BackupDir      string //directory for scheduled database snapshots; disabled if empty
+	BackupInterval int    `default:"1440"` //in minutes
+	BackupRetain   int    `default:"7"`    //number of snapshots to keep
+
+	ReadyCheckLDAP    bool `default:"false"` //check LDAP server is reachable in /readyz
+	ReadyCheckTimeout int  `default:"2"`     //in seconds
+
+	TLSCert string //reloaded on SIGHUP
+	TLSKey  string
+
+	ReadTimeout       int `default:"30"`    //in seconds; 0 for no timeout
+	ReadHeaderTimeout int `default:"10"`    //in seconds; 0 for no timeout
+	WriteTimeout      int `default:"60"`    //in seconds; 0 for no timeout
+	IdleTimeout       int `default:"120"`   //in seconds; 0 for no timeout
+	MaxHeaderBytes    int `default:"65536"` //maximum size of request headers
+	ShutdownTimeout   int `default:"30"`    //in seconds; time to wait for requests to finish on shutdown
+
+	WebhookThresholds   string `default:"100,1000,10000"` //comma-separated view counts that trigger views webhook events
+	WebhookScanInterval int    `default:"60"`             //in seconds; how often to check for expired URLs and view thresholds
+	WebhookTimeout      int    `default:"10"`             //in seconds
+	WebhookMaxAttempts  int    `default:"10"`
+
+	LogLevel  string `default:"info"` //debug, info, warn, or error
+	LogFormat string `default:"json"` //json or text
+
+	PreviewExternal bool   `default:"false"` //show a preview page before redirecting to domains not in InternalDomains
+	InternalDomains string //comma-separated domains (including subdomains) that don't need a preview
+
+	DetectBots    bool   `default:"true"` //count redirects from crawlers and link unfurlers as bot views instead of views
+	BotUserAgents string //comma-separated User-Agent substrings to detect as bots, in addition to the built-in list
+	BotNetworks   string //comma-separated CIDR networks or IP addresses to detect as bots
+
+	TrustedProxies string //comma-separated CIDR networks or IP addresses of reverse proxies whose X-Forwarded-For header is used for client addresses
+
+	Unfurl        bool `default:"false"`   //fetch destination page titles, descriptions, and images for chat app previews
+	UnfurlTimeout int  `default:"5"`       //in seconds
+	UnfurlMaxSize int  `default:"1048576"` //maximum bytes read from a destination page
+
+	PublicURL string //external base URL for short URLs and QR codes, e.g. https://go.example.com; derived from requests if empty
+
+	ListenAddr string `default:":8080" required:"true"` //addr format used for net.Dial; required
+	Prefix     string //url prefix to mount api to without trailing slash
+}
+
+//LDAPConfig represents LDAP options given in the environment.
+//They're only needed to serve, so commands can run without them
+type LDAPConfig struct {
 	LDAPServer     string `required:"true"`
 	LDAPPort       int    `default:"389" required:"true"`
 	LDAPBaseDN     string `required:"true"`
 	LDAPGroup      string
 	LDAPAdminGroup string
 	LDAPSecurity   string `default:"none" required:"true"`
+}
 
-	TLSCert string
-	TLSKey  string
+//ProcessLDAP reads the LDAP options from the environment
+func (c *Config) ProcessLDAP() error {
+	return envconfig.Process("SHORTENER", &c.LDAPConfig)
+}
 
-	ListenAddr string `default:":8080" required:"true"` //addr format used for net.Dial; required
-	Prefix     string //url prefix to mount api to without trailing slash
+//BatchViews returns true if view counts should be batched in memory instead of written on each view
+func (c *Config) BatchViews() bool {
+	switch strings.ToLower(c.ViewDurability) {
+	case "", "sync":
+		return false
+	case "batch":
+		return true
+	default:
+		log.Fatalln("Invalid SHORTENER_VIEWDURABILITY:", c.ViewDurability)
+	}
+	panic("unreachable")
+}
+
+//Generator returns the idgen.Generator for IDStrategy and URLIDLength
+func (c *Config) Generator() idgen.Generator {
+	if c.URLIDLength < 1 {
+		log.Fatalln("Invalid SHORTENER_URLIDLENGTH:", c.URLIDLength)
+	}
+
+	gen, err := idgen.New(c.IDStrategy, c.URLIDLength)
+	if err != nil {
+		log.Fatalln("Invalid SHORTENER_IDSTRATEGY:", c.IDStrategy)
+	}
+
+	if c.IDMaxAttempts < 1 {
+		log.Fatalln("Invalid SHORTENER_IDMAXATTEMPTS:", c.IDMaxAttempts)
+	}
+
+	return gen
+}
+
+//Logger returns a new *logger.Logger writing to stdout for the config
+func (c *Config) Logger() *logger.Logger {
+	level, err := logger.ParseLevel(c.LogLevel)
+	if err != nil {
+		log.Fatalln("Invalid SHORTENER_LOGLEVEL:", c.LogLevel)
+	}
+
+	format, err := logger.ParseFormat(c.LogFormat)
+	if err != nil {
+		log.Fatalln("Invalid SHORTENER_LOGFORMAT:", c.LogFormat)
+	}
+
+	return logger.New(os.Stdout, level, format)
+}
+
+//Thresholds returns the parsed WebhookThresholds
+func (c *Config) Thresholds() []uint64 {
+	var thresholds []uint64
+	for _, s := range strings.Split(c.WebhookThresholds, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		t, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || t == 0 {
+			log.Fatalln("Invalid SHORTENER_WEBHOOKTHRESHOLDS:", c.WebhookThresholds)
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds
+}
+
+//Domains returns the parsed InternalDomains
+func (c *Config) Domains() []string {
+	var domains []string
+	for _, d := range strings.Split(c.InternalDomains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+//Bots returns a new *bot.Classifier for the config, or nil if DetectBots is disabled
+func (c *Config) Bots() *bot.Classifier {
+	if !c.DetectBots {
+		return nil
+	}
+
+	bots, err := bot.New(strings.Split(c.BotUserAgents, ","), strings.Split(c.BotNetworks, ","))
+	if err != nil {
+		log.Fatalln("Invalid SHORTENER_BOTNETWORKS:", err)
+	}
+
+	return bots
+}
+
+//Proxies returns the parsed TrustedProxies
+func (c *Config) Proxies() []*net.IPNet {
+	proxies, err := bot.ParseNetworks(strings.Split(c.TrustedProxies, ","))
+	if err != nil {
+		log.Fatalln("Invalid SHORTENER_TRUSTEDPROXIES:", err)
+	}
+	return proxies
+}
+
+//PublicBaseURL returns the validated PublicURL without a trailing slash
+func (c *Config) PublicBaseURL() string {
+	if c.PublicURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(c.PublicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		log.Fatalln("Invalid SHORTENER_PUBLICURL:", c.PublicURL)
+	}
+
+	return strings.TrimSuffix(c.PublicURL, "/")
 }
 
 //SecurityType returns the auth.SecurityType for the config
@@ -0,0 +1,293 @@
+package bbolt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//aliasesBucket maps alias IDs to the ID of the URL they belong to
+var aliasesBucket = []byte("aliases")
+
+//aliasPrimary returns the ID of the URL the alias id belongs to, or an empty string if id isn't an alias
+func aliasPrimary(tx *bolt.Tx, id string) string {
+	ab := tx.Bucket(aliasesBucket)
+	if ab == nil {
+		return ""
+	}
+	return string(ab.Get([]byte(id)))
+}
+
+//getURLOrAlias returns the record with the given id like getURL. If id is an alias, the record it belongs to
+//is returned with alias set to id
+func getURLOrAlias(tx *bolt.Tx, ub *bolt.Bucket, id string) (rec *record, alias string, err error) {
+	rec, err = getURL(ub, id)
+	if err != nil || rec != nil {
+		return rec, "", err
+	}
+
+	primary := aliasPrimary(tx, id)
+	if primary == "" {
+		return nil, "", nil
+	}
+
+	rec, err = getURL(ub, primary)
+	if err != nil || rec == nil {
+		return rec, "", err
+	}
+
+	return rec, id, nil
+}
+
+//putAliases adds aliases for the URL with the given id, returning the aliases added.
+//Aliases already used by a URL or another alias, ignoring case if IDs are case-insensitive, are skipped
+func (d *DB) putAliases(tx *bolt.Tx, ub *bolt.Bucket, id string, aliases []string) ([]string, error) {
+	ab := tx.Bucket(aliasesBucket)
+	if ab == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, aliasesBucket)
+	}
+
+	added := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if p := aliasPrimary(tx, alias); (p != "" && p != id) || alias == id {
+			log.Printf("WARNING: Skipping alias \"%s\" for URL \"%s\": alias is in use\n", alias, id)
+			continue
+		}
+		if rec, err := getURL(ub, alias); err != nil || (rec != nil && !rec.Deleted) {
+			log.Printf("WARNING: Skipping alias \"%s\" for URL \"%s\": ID is in use\n", alias, id)
+			continue
+		}
+		if used, err := d.foldedUsed(tx, alias); err != nil || used {
+			log.Printf("WARNING: Skipping alias \"%s\" for URL \"%s\": ID is in use ignoring case\n", alias, id)
+			continue
+		}
+
+		if err := ab.Put([]byte(alias), []byte(id)); err != nil {
+			return nil, fmt.Errorf(`Unable to add alias "%s" for url "%s": %v`, alias, id, err)
+		}
+		added = append(added, alias)
+	}
+
+	return added, nil
+}
+
+//deleteAliases removes the aliases belonging to the URL with the given id
+func deleteAliases(tx *bolt.Tx, id string, aliases []string) error {
+	ab := tx.Bucket(aliasesBucket)
+	if ab == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, aliasesBucket)
+	}
+
+	for _, alias := range aliases {
+		if aliasPrimary(tx, alias) != id {
+			continue
+		}
+		if err := ab.Delete([]byte(alias)); err != nil {
+			return fmt.Errorf(`Unable to remove alias "%s" for url "%s": %v`, alias, id, err)
+		}
+	}
+
+	return nil
+}
+
+//AddAlias adds alias as another ID for the *URL with the given id or returns an error if one occurred.
+//If alias is already used by a URL or alias, an error is returned
+func (d *DB) AddAlias(id, alias string) (err error) {
+	alias = d.normalizeID(alias)
+
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	rec, err := d.lookupID(tx, ub, id)
+	if err != nil {
+		return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+	}
+	if rec == nil || rec.Deleted {
+		return fmt.Errorf(`URL "%s" doesn't exist`, id)
+	}
+	id = rec.ID
+
+	if aliasPrimary(tx, alias) != "" || alias == id {
+		return fmt.Errorf("URL %s already exists", alias)
+	}
+	if existing, err := getURL(ub, alias); err != nil || (existing != nil && !existing.Deleted) {
+		if err != nil {
+			return fmt.Errorf("Unable to check existing URL %s: %v", alias, err)
+		}
+		return fmt.Errorf("URL %s already exists", alias)
+	}
+	if used, err := d.foldedUsed(tx, alias); err != nil || used {
+		if err != nil {
+			return fmt.Errorf("Unable to check existing URL %s: %v", alias, err)
+		}
+		return fmt.Errorf("URL %s already exists", alias)
+	}
+
+	if _, err = d.putAliases(tx, ub, id, []string{alias}); err != nil {
+		return err
+	}
+
+	old := rec.URL
+	rec.Aliases = append(append(make([]string, 0, len(old.Aliases)+1), old.Aliases...), alias)
+	sort.Strings(rec.Aliases)
+
+	if err = updateURLIndexes(tx, id, &old, &rec.URL); err != nil {
+		return err
+	}
+
+	return putURL(ub, rec)
+}
+
+//RemoveAlias removes alias from the *URL with the given id or returns an error if one occurred
+func (d *DB) RemoveAlias(id, alias string) (err error) {
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	rec, err := d.lookupID(tx, ub, id)
+	if err != nil {
+		return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+	}
+	if rec == nil || rec.Deleted {
+		return fmt.Errorf(`URL "%s" doesn't exist`, id)
+	}
+	id = rec.ID
+	if d.caseInsensitive {
+		alias = matchFold(rec.Aliases, alias)
+	}
+
+	old := rec.URL
+	rec.Aliases = make([]string, 0, len(old.Aliases))
+	for _, a := range old.Aliases {
+		if a != alias {
+			rec.Aliases = append(rec.Aliases, a)
+		}
+	}
+	if len(rec.Aliases) == len(old.Aliases) {
+		return fmt.Errorf(`Alias "%s" for URL "%s" doesn't exist`, alias, id)
+	}
+
+	if err = deleteAliases(tx, id, []string{alias}); err != nil {
+		return err
+	}
+
+	//views through the alias stay in the URL's total
+	if rec.AliasViews != nil {
+		views := make(map[string]uint64, len(rec.AliasViews))
+		for a, n := range rec.AliasViews {
+			if a != alias {
+				views[a] = n
+			}
+		}
+		rec.AliasViews = views
+	}
+
+	if err = updateURLIndexes(tx, id, &old, &rec.URL); err != nil {
+		return err
+	}
+
+	return putURL(ub, rec)
+}
+
+//checkAliases compares the aliases bucket to expected, a map of alias to the ID of the URL it belongs to,
+//and returns a problem for each missing or stale entry. If repair is true, the entries are fixed
+func checkAliases(tx *bolt.Tx, expected map[string]string, repair bool) ([]*Problem, error) {
+	ab := tx.Bucket(aliasesBucket)
+	if ab == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, aliasesBucket)
+	}
+
+	var problems []*Problem
+	var stale []string
+	err := ab.ForEach(func(k, v []byte) error {
+		if _, ok := expected[string(k)]; !ok {
+			problems = append(problems, &Problem{Type: ProblemOrphaned, ID: string(v), Error: fmt.Sprintf(`stale alias "%s"`, k)})
+			stale = append(stale, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to read "%s" bucket: %v`, aliasesBucket, err)
+	}
+
+	aliases := make([]string, 0, len(expected))
+	for alias := range expected {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	var missing []string
+	for _, alias := range aliases {
+		if primary := aliasPrimary(tx, alias); primary != expected[alias] {
+			p := &Problem{Type: ProblemMissing, ID: expected[alias], Error: fmt.Sprintf(`alias "%s" is missing from %s`, alias, aliasesBucket)}
+			if primary != "" {
+				p.Error = fmt.Sprintf(`alias "%s" belongs to %s in %s`, alias, primary, aliasesBucket)
+			}
+			problems = append(problems, p)
+			missing = append(missing, alias)
+		}
+	}
+
+	if !repair {
+		return problems, nil
+	}
+
+	for _, alias := range stale {
+		if err = ab.Delete([]byte(alias)); err != nil {
+			return nil, fmt.Errorf(`Unable to remove alias "%s": %v`, alias, err)
+		}
+	}
+
+	for _, alias := range missing {
+		if err = ab.Put([]byte(alias), []byte(expected[alias])); err != nil {
+			return nil, fmt.Errorf(`Unable to add alias "%s" for url "%s": %v`, alias, expected[alias], err)
+		}
+	}
+
+	for _, p := range problems {
+		p.Repaired = true
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,223 @@
+package bbolt
+
+import (
+	"fmt"
+	"log"
+)
+
+//Problem types found by CheckRecords
+const (
+	//ProblemCorrupt is a URL record that can't be read
+	ProblemCorrupt = "corrupt"
+	//ProblemOrphaned is an index entry for a URL that doesn't exist, is owned by another user, or has changed
+	ProblemOrphaned = "orphaned"
+	//ProblemMissing is a URL record that isn't in an index it belongs in
+	ProblemMissing = "missing"
+)
+
+//Problem is a problem found by CheckRecords
+type Problem struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	User     string `json:"user,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+//CheckReport is the result of CheckRecords
+type CheckReport struct {
+	URLs     int        `json:"urls"`
+	Users    int        `json:"users"`
+	Problems []*Problem `json:"problems"`
+}
+
+//CheckRecords walks the urls, users, aliases, tags, search, and destinations buckets and reports corrupt URL records, orphaned index entries,
+//and URLs missing from the indexes. If repair is true, orphaned entries are removed, missing entries are added,
+//and URLs stored in an old layout are converted. Records that can't be decoded are only reported
+func (d *DB) CheckRecords(repair bool) (report *CheckReport, err error) {
+	tx, err := d.db.Begin(repair)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database: %v", err)
+	}
+
+	defer func() {
+		if err != nil || !repair {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	usb := tx.Bucket(usersBucket)
+	if usb == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, usersBucket)
+	}
+
+	report = &CheckReport{Problems: make([]*Problem, 0)}
+
+	//owners of readable URL records
+	owners := make(map[string]string)
+	var ids []string
+	legacy := make(map[string]bool)
+	//expected keys and IDs for each of urlIndexes
+	indexes := make([]map[string][]string, len(urlIndexes))
+	for i := range indexes {
+		indexes[i] = make(map[string][]string)
+	}
+	aliases := make(map[string]string)
+
+	err = ub.ForEach(func(k, v []byte) error {
+		ids = append(ids, string(k))
+		if v == nil {
+			legacy[string(k)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read URL IDs: %v", err)
+	}
+
+	for _, id := range ids {
+		report.URLs++
+
+		//URLs written in the version 0 layout after migration, e.g. by restoring an old bucket by hand
+		if legacy[id] {
+			rec := legacyURL(id, ub.Bucket([]byte(id)))
+			p := &Problem{Type: ProblemCorrupt, ID: id, User: rec.User, Error: "URL is stored in version 0 layout"}
+			report.Problems = append(report.Problems, p)
+			if !repair || rec.User == "" || rec.URL.URL == "" {
+				continue
+			}
+			if err = convertLegacyURL(ub, id); err != nil {
+				return nil, err
+			}
+			p.Repaired = true
+		}
+
+		rec, gErr := getURL(ub, id)
+		if gErr != nil {
+			report.Problems = append(report.Problems, &Problem{Type: ProblemCorrupt, ID: id, Error: gErr.Error()})
+			continue
+		}
+		if rec == nil {
+			continue
+		}
+
+		owners[id] = rec.User
+		if !rec.Deleted {
+			for i, idx := range urlIndexes {
+				for _, k := range idx.keys(&rec.URL) {
+					indexes[i][k] = append(indexes[i][k], id)
+				}
+			}
+			for _, alias := range rec.Aliases {
+				aliases[alias] = id
+			}
+		}
+	}
+
+	//check users index for orphaned entries
+	var users []string
+	err = usb.ForEach(func(k, v []byte) error {
+		if v == nil {
+			users = append(users, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read users: %v", err)
+	}
+
+	indexed := make(map[string]bool)
+	for _, user := range users {
+		report.Users++
+		b := usb.Bucket([]byte(user))
+
+		var orphaned []*Problem
+		err = b.ForEach(func(k, v []byte) error {
+			id := string(k)
+			owner, ok := owners[id]
+			if ok && owner == user {
+				indexed[id] = true
+				return nil
+			}
+
+			//corrupt records have already been reported
+			if !ok && (ub.Get(k) != nil || legacy[id]) {
+				return nil
+			}
+
+			p := &Problem{Type: ProblemOrphaned, ID: id, User: user, Error: "URL doesn't exist"}
+			if ok {
+				p.Error = fmt.Sprintf("URL is owned by %s", owner)
+			}
+			report.Problems = append(report.Problems, p)
+			orphaned = append(orphaned, p)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf(`Unable to read user "%s" URLs: %v`, user, err)
+		}
+
+		if !repair {
+			continue
+		}
+
+		for _, p := range orphaned {
+			if err = b.Delete([]byte(p.ID)); err != nil {
+				return nil, fmt.Errorf(`Unable to remove url "%s" from user "%s": %v`, p.ID, user, err)
+			}
+			p.Repaired = true
+		}
+
+		if k, _ := b.Cursor().First(); k == nil {
+			if err = usb.DeleteBucket([]byte(user)); err != nil {
+				return nil, fmt.Errorf(`Unable to remove user "%s" bucket: %v`, user, err)
+			}
+		}
+	}
+
+	//check for URLs missing from users index
+	for _, id := range ids {
+		owner, ok := owners[id]
+		if !ok || indexed[id] {
+			continue
+		}
+
+		p := &Problem{Type: ProblemMissing, ID: id, User: owner, Error: "URL is missing from users index"}
+		report.Problems = append(report.Problems, p)
+		if !repair {
+			continue
+		}
+		if err = putUserID(tx, owner, id); err != nil {
+			return nil, err
+		}
+		p.Repaired = true
+	}
+
+	for i, idx := range urlIndexes {
+		problems, err := checkIndex(tx, idx.name, indexes[i], repair)
+		if err != nil {
+			return nil, err
+		}
+		report.Problems = append(report.Problems, problems...)
+	}
+
+	problems, err := checkAliases(tx, aliases, repair)
+	if err != nil {
+		return nil, err
+	}
+	report.Problems = append(report.Problems, problems...)
+
+	return report, nil
+}
@@ -1,106 +1,90 @@
 package bbolt
 
 import (
-	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/korylprince/url-shortener-server/v2/db"
-	"github.com/korylprince/url-shortener-server/v2/rand"
+	"github.com/korylprince/url-shortener-server/v2/idgen"
 	bolt "go.etcd.io/bbolt"
 )
 
+//openTimeout is the time to wait to obtain a lock on the database file
+const openTimeout = 5 * time.Second
+
 var urlsBucket = []byte("urls")
 var usersBucket = []byte("users")
+var signaturesBucket = []byte("signatures")
 
-var userKey = []byte("user")
-var urlKey = []byte("url")
-var viewsKey = []byte("views")
-var expiresKey = []byte("expires")
-var deletedKey = []byte("deleted")
-var modifiedKey = []byte("modified")
-
-func getURL(b *bolt.Bucket) (*db.URL, error) {
-	bUser := b.Get(userKey)
-	if bUser == nil {
-		return nil, fmt.Errorf(`Unable to get "%s" value: value is nil`, userKey)
-	}
+//record is the value stored for each URL
+type record struct {
+	db.URL
+	Deleted bool `json:"deleted,omitempty"`
 
-	bURL := b.Get(urlKey)
-	if bURL == nil {
-		return nil, fmt.Errorf(`Unable to get "%s" value: value is nil`, urlKey)
-	}
+	//webhook event state; see ScanEvents
+	ExpiryNotified bool   `json:"expiry_notified,omitempty"`
+	ViewsNotified  uint64 `json:"views_notified,omitempty"`
+}
 
-	bViews := b.Get(viewsKey)
-	if bViews == nil {
-		return nil, fmt.Errorf(`Unable to get "%s" value: value is nil`, viewsKey)
+//getURL returns the record with the given id or nil if it doesn't exist, or an error if one occurred
+func getURL(ub *bolt.Bucket, id string) (*record, error) {
+	v := ub.Get([]byte(id))
+	if v == nil {
+		return nil, nil
 	}
 
-	views, read := binary.Uvarint(bViews)
-	if read < 1 {
-		return nil, fmt.Errorf(`Unable to decode "%s" value "%v": number of bytes read is %d`, viewsKey, bViews, read)
+	rec := new(record)
+	if err := json.Unmarshal(v, rec); err != nil {
+		return nil, fmt.Errorf(`Unable to decode url "%s": %v`, id, err)
 	}
 
-	url := &db.URL{
-		User:  string(bUser),
-		URL:   string(bURL),
-		Views: views,
+	if rec.User == "" || rec.URL.URL == "" {
+		return nil, fmt.Errorf(`Unable to decode url "%s": user or url is empty`, id)
 	}
 
-	if bExpires := b.Get(expiresKey); bExpires != nil {
-		expires := new(time.Time)
-		if err := expires.UnmarshalBinary(bExpires); err != nil {
-			return nil, fmt.Errorf(`Unable to get "%s" value: %v`, expiresKey, err)
-		}
-		url.Expires = expires
+	rec.ID = id
+	if rec.Tags == nil {
+		rec.Tags = make([]string, 0)
 	}
-
-	bModified := b.Get(modifiedKey)
-	modified := new(time.Time)
-	if err := modified.UnmarshalBinary(bModified); err != nil {
-		return nil, fmt.Errorf(`Unable to get "%s" value: %v`, modifiedKey, err)
+	if rec.Aliases == nil {
+		rec.Aliases = make([]string, 0)
 	}
-	url.LastModified = modified
 
-	return url, nil
+	return rec, nil
 }
 
-func putURL(b *bolt.Bucket, url *db.URL) error {
-	if err := b.Put(userKey, []byte(url.User)); err != nil {
-		return fmt.Errorf(`Unable to put "%s" value "%s": %v`, userKey, url.User, err)
+//putURL encodes and stores the given record
+func putURL(ub *bolt.Bucket, rec *record) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf(`Unable to encode url "%s": %v`, rec.ID, err)
 	}
 
-	if err := b.Put(urlKey, []byte(url.URL)); err != nil {
-		return fmt.Errorf(`Unable to put "%s" value "%s": %v`, urlKey, url.URL, err)
+	if err = ub.Put([]byte(rec.ID), buf); err != nil {
+		return fmt.Errorf(`Unable to put url "%s": %v`, rec.ID, err)
 	}
 
-	bViews := make([]byte, 8) //size of uint64
-	binary.PutUvarint(bViews, url.Views)
-
-	if err := b.Put(viewsKey, bViews); err != nil {
-		return fmt.Errorf(`Unable to put "%s" value "%v": %v`, viewsKey, bViews, err)
-	}
+	return nil
+}
 
-	if url.Expires != nil {
-		bExpires, err := url.Expires.MarshalBinary()
-		if err != nil {
-			return fmt.Errorf(`Unable to marshal "%s" value "%v": %v`, expiresKey, url.Expires, err)
-		}
-		if err = b.Put(expiresKey, bExpires); err != nil {
-			return fmt.Errorf(`Unable to put "%s" value "%s": %v`, expiresKey, bExpires, err)
-		}
-	} else if err := b.Delete(expiresKey); err != nil {
-		return fmt.Errorf(`Unable to delete "%s": %v`, expiresKey, err)
+func putUserID(tx *bolt.Tx, user, id string) error {
+	ub := tx.Bucket(usersBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, usersBucket)
 	}
 
-	modified := time.Now()
-	bModified, err := modified.MarshalBinary()
+	b, err := ub.CreateBucketIfNotExists([]byte(user))
 	if err != nil {
-		return fmt.Errorf(`Unable to marshal "%s" value "%v": %v`, expiresKey, modified, err)
+		return fmt.Errorf(`Unable to create user "%s" bucket: %v`, user, err)
 	}
-	if err = b.Put(modifiedKey, bModified); err != nil {
-		return fmt.Errorf(`Unable to put "%s" value "%s": %v`, modifiedKey, bModified, err)
+
+	if err = b.Put([]byte(id), nil); err != nil {
+		return fmt.Errorf(`Unable to add url "%s" to user "%s": %v`, id, user, err)
 	}
 
 	return nil
@@ -108,18 +92,46 @@ func putURL(b *bolt.Bucket, url *db.URL) error {
 
 //DB is a BBolt DB
 type DB struct {
-	db       *bolt.DB
-	idLength int
+	db   *bolt.DB
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	//gen generates new URL IDs; see SetGenerator
+	gen         idgen.Generator
+	maxAttempts int
+
+	//views and botViews accumulate view counts by URL ID, and aliasViews by alias, when batching is enabled; nil otherwise
+	views      *viewCounter
+	aliasViews *viewCounter
+	botViews   *viewCounter
+
+	//caseInsensitive is set by CaseInsensitiveIDs
+	caseInsensitive bool
 }
 
-//New returns a new *BBoltDB with the given path and id length
+//New returns a new *BBoltDB with the given path, generating random IDs of the given length,
 //or an error if one occurred
 func New(path string, idLength int) (*DB, error) {
-	db, err := bolt.Open(path, 0600, nil)
+	gen, err := idgen.New("random", idLength)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("Unable to open database %s: database is locked by another process", path)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Unable to create database %s: %v", path, err)
 	}
 
+	d := &DB{db: db, gen: gen, maxAttempts: DefaultMaxAttempts, done: make(chan struct{})}
+
+	if err = d.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Unable to migrate database %s: %v", path, err)
+	}
+
 	tx, err := db.Begin(true)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to open database %s for writing: %v", path, err)
@@ -135,11 +147,22 @@ func New(path string, idLength int) (*DB, error) {
 		return nil, fmt.Errorf(`Unable to create database %s "%s" bucket: %v`, path, usersBucket, err)
 	}
 
+	_, err = tx.CreateBucketIfNotExists(signaturesBucket)
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to create database %s "%s" bucket: %v`, path, signaturesBucket, err)
+	}
+
+	for _, name := range [][]byte{webhooksBucket, queueBucket, scheduleBucket, deliveriesBucket, displayNamesBucket, tagsBucket, searchBucket, destinationsBucket, aliasesBucket, foldedBucket} {
+		if _, err = tx.CreateBucketIfNotExists(name); err != nil {
+			return nil, fmt.Errorf(`Unable to create database %s "%s" bucket: %v`, path, name, err)
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("Unable to commit transaction %s: %v", path, err)
 	}
 
-	return &DB{db: db, idLength: idLength}, nil
+	return d, nil
 }
 
 //Get returns the *URL with the given id, or an error if one occurred.
@@ -161,24 +184,31 @@ func (d *DB) Get(id string) (url *db.URL, err error) {
 		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	b := ub.Bucket([]byte(id))
-	if b == nil {
-		return nil, nil
-	}
-
-	url, err = getURL(b)
+	rec, _, err := d.lookup(tx, ub, id)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to unmarshal URL: %v", err)
+		return nil, err
 	}
 
 	//check for deleted URL
-	if b.Get(deletedKey) != nil {
+	if rec == nil || rec.Deleted {
 		return nil, nil
 	}
 
-	url.ID = id
+	//include views not yet flushed
+	rec.Views += d.views.pending(rec.ID)
+	rec.BotViews += d.botViews.pending(rec.ID)
+	for _, alias := range rec.Aliases {
+		n := d.aliasViews.pending(alias)
+		if n == 0 {
+			continue
+		}
+		if rec.AliasViews == nil {
+			rec.AliasViews = make(map[string]uint64)
+		}
+		rec.AliasViews[alias] += n
+	}
 
-	return url, err
+	return &rec.URL, nil
 }
 
 //Put saves the given url in the database for the given user, returning the id, or an error if one occurred.
@@ -207,69 +237,224 @@ func (d *DB) Put(url *db.URL, user string) (id string, err error) {
 		return "", fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	id = url.ID
+	id = d.normalizeID(url.ID)
 
 	if id == "" {
-		//generate random, unused id if not set
-		for {
-			id = rand.String(d.idLength)
-			if ub.Bucket([]byte(id)) == nil {
-				break
-			}
+		//generate unused id if not set
+		if id, err = d.generateID(tx, ub); err != nil {
+			return "", err
 		}
-	} else if b := ub.Bucket([]byte(id)); b != nil {
-		if b.Get(deletedKey) == nil {
-			return "", fmt.Errorf("URL %s already exists", id)
+	} else if rec, err := getURL(ub, id); err != nil || (rec != nil && !rec.Deleted) || aliasPrimary(tx, id) != "" {
+		if err != nil {
+			return "", fmt.Errorf("Unable to check existing URL %s: %v", id, err)
 		}
-		if err := ub.DeleteBucket([]byte(id)); err != nil {
-			return "", fmt.Errorf("Unable to remove deleted URL %s: %v", id, err)
+		return "", fmt.Errorf("URL %s already exists", id)
+	} else if used, err := d.foldedUsed(tx, id); err != nil || used {
+		if err != nil {
+			return "", fmt.Errorf("Unable to check existing URL %s: %v", id, err)
 		}
+		return "", fmt.Errorf("URL %s already exists", id)
 	}
 
-	b, err := ub.CreateBucketIfNotExists([]byte(id))
-	if err != nil {
-		return "", fmt.Errorf(`Unable to create url "%s" bucket: %v`, id, err)
+	if url.Tags, err = db.NormalizeTags(url.Tags); err != nil {
+		return "", err
 	}
 
+	created := time.Now()
+	url.ID = id
 	url.User = user
 	url.Views = 0
+	url.BotViews = 0
+	url.Aliases = make([]string, 0)
+	url.AliasViews = nil
+	url.Unfurl = nil
+	url.Created = &created
+	url.CreatedBy = user
+	url.LastModified = &created
+	url.ModifiedBy = user
 
-	if err = putURL(b, url); err != nil {
-		return "", fmt.Errorf(`Unable to marshal "%s" URL: %v`, id, err)
+	if err = putURL(ub, &record{URL: *url}); err != nil {
+		return "", err
+	}
+
+	if err = updateURLIndexes(tx, id, nil, url); err != nil {
+		return "", err
 	}
 
 	//store user
-	ub = tx.Bucket(usersBucket)
-	if ub == nil {
-		return "", fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, usersBucket)
+	if err = putUserID(tx, user, id); err != nil {
+		return "", err
 	}
 
-	b, err = ub.CreateBucketIfNotExists([]byte(user))
+	return id, nil
+}
+
+//Import saves the given url in the database as-is, preserving its ID, User, Views, Created, and LastModified,
+//or returns an error if one occurred. If a *URL with the same id already exists, an error is returned.
+//Missing Created and LastModified times default to each other or the current time.
+//If IDs are case-insensitive, the ID and aliases are lowercased like new URLs
+func (d *DB) Import(url *db.URL) (err error) {
+	if url.ID == "" {
+		return errors.New("URL ID is empty")
+	}
+
+	url.ID = d.normalizeID(url.ID)
+	if db.ReservedID(url.ID) {
+		return fmt.Errorf("URL ID %s is reserved", url.ID)
+	}
+
+	if d.caseInsensitive {
+		aliases := make([]string, 0, len(url.Aliases))
+		seen := make(map[string]bool, len(url.Aliases))
+		for _, alias := range url.Aliases {
+			if alias = d.normalizeID(alias); !seen[alias] {
+				seen[alias] = true
+				aliases = append(aliases, alias)
+			}
+		}
+		url.Aliases = aliases
+	}
+
+	tx, err := d.db.Begin(true)
 	if err != nil {
-		return "", fmt.Errorf(`Unable to create user "%s" bucket: %v`, user, err)
+		return fmt.Errorf("Unable to open database for writing: %v", err)
 	}
 
-	if err = b.Put([]byte(id), nil); err != nil {
-		return "", fmt.Errorf(`Unable to add url "%s" to user "%s": %v`, id, user, err)
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	return id, nil
+	if rec, err := getURL(ub, url.ID); err != nil || (rec != nil && !rec.Deleted) || aliasPrimary(tx, url.ID) != "" {
+		if err != nil {
+			return fmt.Errorf("Unable to check existing URL %s: %v", url.ID, err)
+		}
+		return fmt.Errorf("URL %s already exists", url.ID)
+	}
+	if used, err := d.foldedUsed(tx, url.ID); err != nil || used {
+		if err != nil {
+			return fmt.Errorf("Unable to check existing URL %s: %v", url.ID, err)
+		}
+		return fmt.Errorf("URL %s already exists", url.ID)
+	}
+
+	if url.Tags, err = db.NormalizeTags(url.Tags); err != nil {
+		return err
+	}
+
+	//aliases already in use are skipped
+	if url.Aliases, err = d.putAliases(tx, ub, url.ID, url.Aliases); err != nil {
+		return err
+	}
+	sort.Strings(url.Aliases)
+
+	if url.Created == nil {
+		created := time.Now()
+		if url.LastModified != nil {
+			created = *(url.LastModified)
+		}
+		url.Created = &created
+	}
+	if url.LastModified == nil {
+		url.LastModified = url.Created
+	}
+	if url.CreatedBy == "" {
+		url.CreatedBy = url.User
+	}
+	if url.ModifiedBy == "" {
+		url.ModifiedBy = url.CreatedBy
+	}
+
+	//imported view counts and expirations happened before webhooks could be notified
+	rec := &record{URL: *url, ViewsNotified: url.Views, ExpiryNotified: url.Expires != nil && time.Now().After(*(url.Expires))}
+	if err = putURL(ub, rec); err != nil {
+		return err
+	}
+
+	if err = updateURLIndexes(tx, url.ID, nil, url); err != nil {
+		return err
+	}
+
+	return putUserID(tx, url.User, url.ID)
 }
 
-//Update updates the *URL with the given id or returns an error if one occurred
-func (d *DB) Update(id string, url *db.URL) error {
-	u, err := d.Get(id)
+//Update updates the *URL with the given id as the given user or returns an error if one occurred.
+//Created and CreatedBy are preserved
+func (d *DB) Update(id string, url *db.URL, user string) (err error) {
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	rec, err := d.lookupID(tx, ub, id)
 	if err != nil {
 		return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
 	}
-	if u == nil {
+	if rec == nil || rec.Deleted {
 		return fmt.Errorf(`Unable to get URL "%s": URL doesn't exist`, id)
 	}
+	id = rec.ID
+
+	if url.Tags, err = db.NormalizeTags(url.Tags); err != nil {
+		return err
+	}
 
+	modified := time.Now()
 	url.ID = id
-	url.User = u.User
-	url.Views = u.Views
+	url.User = rec.User
+	url.Views = rec.Views
+	url.BotViews = rec.BotViews
+	url.Aliases = rec.Aliases
+	url.AliasViews = rec.AliasViews
+	url.Unfurl = rec.Unfurl
+	url.Created = rec.Created
+	url.CreatedBy = rec.CreatedBy
+	url.LastModified = &modified
+	url.ModifiedBy = user
 
+	if err = updateURLIndexes(tx, id, &rec.URL, url); err != nil {
+		return err
+	}
+
+	//only notify expiration again if it changed
+	sameExpires := (rec.Expires == nil && url.Expires == nil) || (rec.Expires != nil && url.Expires != nil && rec.Expires.Equal(*(url.Expires)))
+
+	return putURL(ub, &record{URL: *url, ExpiryNotified: rec.ExpiryNotified && sameExpires, ViewsNotified: rec.ViewsNotified})
+}
+
+//Delete deletes the *URL with the given id as the given user or returns an error if one occurred
+func (d *DB) Delete(id, user string) (err error) {
 	tx, err := d.db.Begin(true)
 	if err != nil {
 		return fmt.Errorf("Unable to open database for writing: %v", err)
@@ -293,20 +478,34 @@ func (d *DB) Update(id string, url *db.URL) error {
 		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	b := ub.Bucket([]byte(id))
-	if b == nil {
-		return fmt.Errorf(`Unable to open url "%s" bucket: bucket is nil`, id)
+	rec, err := d.lookupID(tx, ub, id)
+	if err != nil {
+		return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+	}
+	if rec == nil {
+		return fmt.Errorf(`URL "%s" doesn't exist`, id)
 	}
+	id = rec.ID
 
-	if err = putURL(b, url); err != nil {
-		return fmt.Errorf(`Unable to update "%s" URL: %v`, id, err)
+	if err = updateURLIndexes(tx, id, &rec.URL, nil); err != nil {
+		return err
 	}
 
-	return nil
+	//aliases are kept on the record to be restored with it
+	if err = deleteAliases(tx, id, rec.Aliases); err != nil {
+		return err
+	}
+
+	modified := time.Now()
+	rec.LastModified = &modified
+	rec.ModifiedBy = user
+	rec.Deleted = true
+
+	return putURL(ub, rec)
 }
 
-//Delete deletes the *URL with the given id or returns an error if one occurred
-func (d *DB) Delete(id string) error {
+//Restore restores the deleted *URL with the given id as the given user or returns an error if one occurred
+func (d *DB) Restore(id, user string) (err error) {
 	tx, err := d.db.Begin(true)
 	if err != nil {
 		return fmt.Errorf("Unable to open database for writing: %v", err)
@@ -325,50 +524,133 @@ func (d *DB) Delete(id string) error {
 		}
 	}()
 
-	//
 	ub := tx.Bucket(urlsBucket)
 	if ub == nil {
 		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	b := ub.Bucket([]byte(id))
-	if b == nil {
-		return fmt.Errorf(`Unable to open url "%s" bucket: bucket is nil`, id)
+	rec, err := d.lookupID(tx, ub, id)
+	if err != nil {
+		return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+	}
+	if rec == nil {
+		return fmt.Errorf(`URL "%s" doesn't exist`, id)
+	}
+	id = rec.ID
+	if !rec.Deleted {
+		return fmt.Errorf("URL %s is not deleted", id)
+	}
+	if primary := aliasPrimary(tx, id); primary != "" {
+		return fmt.Errorf("URL %s is in use as an alias of %s", id, primary)
+	}
+	if used, err := d.foldedUsed(tx, id); err != nil || used {
+		if err != nil {
+			return fmt.Errorf("Unable to check existing URL %s: %v", id, err)
+		}
+		return fmt.Errorf("URL %s is in use ignoring case", id)
+	}
+
+	//aliases taken since the URL was deleted are dropped
+	if rec.Aliases, err = d.putAliases(tx, ub, id, rec.Aliases); err != nil {
+		return err
 	}
 
 	modified := time.Now()
-	bModified, err := modified.MarshalBinary()
-	if err != nil {
-		return fmt.Errorf(`Unable to marshal "%s" value "%v": %v`, expiresKey, modified, err)
+	rec.LastModified = &modified
+	rec.ModifiedBy = user
+	rec.Deleted = false
+
+	if err = putURL(ub, rec); err != nil {
+		return err
 	}
-	if err = b.Put(modifiedKey, bModified); err != nil {
-		return fmt.Errorf(`Unable to put "%s" value "%s": %v`, modifiedKey, bModified, err)
+
+	if err = updateURLIndexes(tx, id, nil, &rec.URL); err != nil {
+		return err
 	}
 
-	return b.Put(deletedKey, nil)
+	return putUserID(tx, rec.User, id)
 }
 
-//View returns the url with the given id, or an error if one occurred.
-//If a URL with the given id doesn't exist, url will be empty.
-//View increments the view counter for the URL and should be used
-//by clients wanting to resolve the shortened URL.
-func (d *DB) View(id string) (url string, err error) {
-	u, err := d.Get(id)
+//Transfer changes the owner of the *URL with the given id to owner as the given user or returns an error if one occurred
+func (d *DB) Transfer(id, owner, user string) (err error) {
+	tx, err := d.db.Begin(true)
 	if err != nil {
-		return "", fmt.Errorf(`Unable to get url "%s": %v`, id, err)
+		return fmt.Errorf("Unable to open database for writing: %v", err)
 	}
 
-	//check exists
-	if u == nil {
-		return "", nil
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	//check expired
-	if u.Expires != nil && time.Now().After(*(u.Expires)) {
-		return "", nil
+	rec, err := d.lookupID(tx, ub, id)
+	if err != nil {
+		return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+	}
+	if rec == nil || rec.Deleted {
+		return fmt.Errorf(`URL "%s" doesn't exist`, id)
+	}
+	id = rec.ID
+	url := &rec.URL
+
+	usb := tx.Bucket(usersBucket)
+	if usb == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, usersBucket)
+	}
+
+	//remove from previous user
+	if ob := usb.Bucket([]byte(url.User)); ob != nil {
+		if err = ob.Delete([]byte(id)); err != nil {
+			return fmt.Errorf(`Unable to remove url "%s" from user "%s": %v`, id, url.User, err)
+		}
+		if k, _ := ob.Cursor().First(); k == nil {
+			if err = usb.DeleteBucket([]byte(url.User)); err != nil {
+				return fmt.Errorf(`Unable to remove user "%s" bucket: %v`, url.User, err)
+			}
+		}
 	}
 
-	//increment views
+	old := *url
+
+	modified := time.Now()
+	url.User = owner
+	url.LastModified = &modified
+	url.ModifiedBy = user
+
+	if err = putURL(ub, rec); err != nil {
+		return err
+	}
+
+	if err = updateURLIndexes(tx, id, &old, url); err != nil {
+		return err
+	}
+
+	return putUserID(tx, owner, id)
+}
+
+//View returns the url with the given id, or an error if one occurred.
+//If a URL with the given id doesn't exist, url will be empty. If it's expired, err will be db.ErrExpired.
+//View increments the view counter for the URL and should be used
+//by clients wanting to resolve the shortened URL.
+func (d *DB) View(id string) (url string, err error) {
+	if d.views != nil {
+		return d.viewBatched(id)
+	}
+
+	//read and increment views in a single transaction so concurrent views aren't lost
 	tx, err := d.db.Begin(true)
 	if err != nil {
 		return "", fmt.Errorf("Unable to open database for writing: %v", err)
@@ -392,19 +674,34 @@ func (d *DB) View(id string) (url string, err error) {
 		return "", fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
 	}
 
-	b := ub.Bucket([]byte(id))
-	if b == nil {
-		return "", fmt.Errorf(`Unable to open url "%s" bucket: bucket is nil`, id)
+	rec, alias, err := d.lookup(tx, ub, id)
+	if err != nil {
+		return "", fmt.Errorf(`Unable to get url "%s": %v`, id, err)
 	}
 
-	bViews := make([]byte, 8) //size of uint64
-	binary.PutUvarint(bViews, u.Views+1)
+	//check exists
+	if rec == nil || rec.Deleted {
+		return "", nil
+	}
+
+	//check expired
+	if rec.Expires != nil && time.Now().After(*(rec.Expires)) {
+		return "", db.ErrExpired
+	}
+
+	rec.Views++
+	if alias != "" {
+		if rec.AliasViews == nil {
+			rec.AliasViews = make(map[string]uint64)
+		}
+		rec.AliasViews[alias]++
+	}
 
-	if err = b.Put(viewsKey, bViews); err != nil {
-		return "", fmt.Errorf(`Unable to put "%s" value "%v": %v`, viewsKey, bViews, err)
+	if err = putURL(ub, rec); err != nil {
+		return "", err
 	}
 
-	return u.URL, nil
+	return rec.URL.URL, nil
 }
 
 func (d *DB) getUserIDs(user string) ([]string, error) {
@@ -462,9 +759,7 @@ func (d *DB) getAllIDs() ([]string, error) {
 	var ids []string
 
 	err = ub.ForEach(func(k, v []byte) error {
-		if v == nil {
-			ids = append(ids, string(k))
-		}
+		ids = append(ids, string(k))
 		return nil
 	})
 	if err != nil {
@@ -496,7 +791,9 @@ func (d *DB) URLs(user string) ([]*db.URL, error) {
 	for _, id := range ids {
 		url, err := d.Get(id)
 		if err != nil {
-			return nil, fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+			//skip bad records so one doesn't break the whole listing; see CheckRecords
+			log.Printf("WARNING: Unable to get URL \"%s\": %v\n", id, err)
+			continue
 		}
 		if url != nil {
 			url.ID = id
@@ -506,3 +803,97 @@ func (d *DB) URLs(user string) ([]*db.URL, error) {
 
 	return urls, nil
 }
+
+//Signatures returns a map of user to API signature token or an error if one occurred
+func (d *DB) Signatures() (signatures map[string]string, err error) {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	defer func() {
+		if rErr := tx.Rollback(); rErr != nil && err == nil {
+			err = fmt.Errorf("Unable to rollback read-only transaction: %v", rErr)
+		}
+	}()
+
+	sb := tx.Bucket(signaturesBucket)
+	if sb == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, signaturesBucket)
+	}
+
+	signatures = make(map[string]string)
+	err = sb.ForEach(func(k, v []byte) error {
+		signatures[string(k)] = string(v)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read signatures: %v", err)
+	}
+
+	return signatures, nil
+}
+
+//SetSignature sets the API signature token for the given user or returns an error if one occurred
+func (d *DB) SetSignature(user, signature string) (err error) {
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	sb := tx.Bucket(signaturesBucket)
+	if sb == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, signaturesBucket)
+	}
+
+	if err = sb.Put([]byte(user), []byte(signature)); err != nil {
+		return fmt.Errorf(`Unable to put signature for user "%s": %v`, user, err)
+	}
+
+	return nil
+}
+
+//Users returns the users that own URLs or an error if one occurred
+func (d *DB) Users() (users []string, err error) {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	defer func() {
+		if rErr := tx.Rollback(); rErr != nil && err == nil {
+			err = fmt.Errorf("Unable to rollback read-only transaction: %v", rErr)
+		}
+	}()
+
+	ub := tx.Bucket(usersBucket)
+	if ub == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, usersBucket)
+	}
+
+	users = make([]string, 0)
+	err = ub.ForEach(func(k, v []byte) error {
+		if v == nil {
+			users = append(users, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read users: %v", err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,117 @@
+package bbolt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//destinationsBucket is an index of normalized destinations to URL IDs
+var destinationsBucket = []byte("destinations")
+
+//destinationKeys returns the destinations index key for url. Destinations too long to be a key aren't indexed
+func destinationKeys(url *db.URL) []string {
+	dest := db.NormalizeDestination(url.URL)
+	if dest == "" || len(dest) > bolt.MaxKeySize {
+		return nil
+	}
+	return []string{dest}
+}
+
+//getURLs returns the URLs with the given ids, skipping URLs that don't exist or aren't owned by user if it's not empty
+func (d *DB) getURLs(user string, ids []string) []*db.URL {
+	urls := make([]*db.URL, 0, len(ids))
+	for _, id := range ids {
+		url, err := d.Get(id)
+		if err != nil {
+			log.Printf("WARNING: Unable to get URL \"%s\": %v\n", id, err)
+			continue
+		}
+		//the URL may have changed since the index was read
+		if url != nil && (user == "" || url.User == user) {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+//DestinationURLs returns the URLs for the given user, or all users if user is empty, whose destination
+//is the same as destination after normalizing both with NormalizeDestination, or an error if one occurred
+func (d *DB) DestinationURLs(user, destination string) ([]*db.URL, error) {
+	keys := destinationKeys(&db.URL{URL: destination})
+	if len(keys) == 0 {
+		return make([]*db.URL, 0), nil
+	}
+
+	var ids []string
+	err := d.db.View(func(tx *bolt.Tx) error {
+		indexed, err := indexIDs(tx, destinationsBucket, keys[0])
+		if err != nil {
+			return err
+		}
+		for _, id := range indexed {
+			if userOwns(tx, user, id) {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to get destination "%s" URL IDs: %v`, destination, err)
+	}
+
+	return d.getURLs(user, ids), nil
+}
+
+//Duplicates returns the destinations shared by more than one URL, with the most shared first,
+//or an error if one occurred
+func (d *DB) Duplicates() ([]*db.Duplicate, error) {
+	shared := make(map[string][]string)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		dsb := tx.Bucket(destinationsBucket)
+		if dsb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, destinationsBucket)
+		}
+
+		return dsb.ForEach(func(k, v []byte) error {
+			b := dsb.Bucket(k)
+			if b == nil {
+				return nil
+			}
+			var ids []string
+			if err := b.ForEach(func(id, v []byte) error {
+				ids = append(ids, string(id))
+				return nil
+			}); err != nil {
+				return err
+			}
+			if len(ids) > 1 {
+				shared[string(k)] = ids
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read destinations: %v", err)
+	}
+
+	duplicates := make([]*db.Duplicate, 0, len(shared))
+	for dest, ids := range shared {
+		if urls := d.getURLs("", ids); len(urls) > 1 {
+			duplicates = append(duplicates, &db.Duplicate{Destination: dest, URLs: urls})
+		}
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i].URLs) != len(duplicates[j].URLs) {
+			return len(duplicates[i].URLs) > len(duplicates[j].URLs)
+		}
+		return duplicates[i].Destination < duplicates[j].Destination
+	})
+
+	return duplicates, nil
+}
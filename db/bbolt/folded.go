@@ -0,0 +1,167 @@
+package bbolt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//foldedBucket is an index of lowercased IDs and aliases to URL IDs, used for case-insensitive lookups
+var foldedBucket = []byte("folded")
+
+//foldedKeys returns the folded index keys for url
+func foldedKeys(url *db.URL) []string {
+	keys := []string{strings.ToLower(url.ID)}
+	for _, alias := range url.Aliases {
+		keys = append(keys, strings.ToLower(alias))
+	}
+	return keys
+}
+
+//CaseInsensitiveIDs makes URL IDs case-insensitive. New custom IDs and aliases are lowercased, new IDs can't match
+//an existing ID or alias ignoring case, and lookups that don't match exactly match ignoring case.
+//It should be called before the DB is used
+func (d *DB) CaseInsensitiveIDs() {
+	d.caseInsensitive = true
+}
+
+//normalizeID returns id lowercased if IDs are case-insensitive
+func (d *DB) normalizeID(id string) string {
+	if d.caseInsensitive {
+		return strings.ToLower(id)
+	}
+	return id
+}
+
+//foldedUsed returns true if IDs are case-insensitive and a URL or alias matches id ignoring case,
+//or an error if one occurred
+func (d *DB) foldedUsed(tx *bolt.Tx, id string) (bool, error) {
+	if !d.caseInsensitive {
+		return false, nil
+	}
+
+	ids, err := indexIDs(tx, foldedBucket, strings.ToLower(id))
+	if err != nil {
+		return false, err
+	}
+
+	return len(ids) > 0, nil
+}
+
+//lookup returns the record with the given id or alias like getURLOrAlias. If IDs are case-insensitive
+//and nothing matches exactly, the URL or alias matching id ignoring case is returned. If more than one URL matches,
+//the one with the lowercased id is returned, or nil if there isn't one
+func (d *DB) lookup(tx *bolt.Tx, ub *bolt.Bucket, id string) (rec *record, alias string, err error) {
+	rec, alias, err = getURLOrAlias(tx, ub, id)
+	if err != nil || rec != nil || !d.caseInsensitive {
+		return rec, alias, err
+	}
+
+	folded := strings.ToLower(id)
+	ids, err := indexIDs(tx, foldedBucket, folded)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+
+	//prefer the lowercased id, since custom IDs are normalized to it
+	if len(ids) > 1 {
+		if folded == id {
+			return nil, "", nil
+		}
+		return getURLOrAlias(tx, ub, folded)
+	}
+
+	if rec, err = getURL(ub, ids[0]); err != nil || rec == nil {
+		return rec, "", err
+	}
+
+	if strings.EqualFold(rec.ID, id) {
+		return rec, "", nil
+	}
+	for _, a := range rec.Aliases {
+		if strings.EqualFold(a, id) {
+			return rec, a, nil
+		}
+	}
+
+	return rec, "", nil
+}
+
+//lookupID returns the record with the given id, including deleted records, or nil if it doesn't exist.
+//If IDs are case-insensitive and nothing matches exactly, the URL matching id ignoring case is returned.
+//Unlike lookup, aliases don't match
+func (d *DB) lookupID(tx *bolt.Tx, ub *bolt.Bucket, id string) (*record, error) {
+	rec, err := getURL(ub, id)
+	if err != nil || rec != nil || !d.caseInsensitive {
+		return rec, err
+	}
+
+	rec, alias, err := d.lookup(tx, ub, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil && alias == "" {
+		return rec, nil
+	}
+
+	//deleted URLs aren't in the folded index, but their IDs were lowercased when they were created
+	return getURL(ub, strings.ToLower(id))
+}
+
+//matchFold returns the value in values equal to s, or else the first one equal to s ignoring case,
+//or s if there isn't one
+func matchFold(values []string, s string) string {
+	for _, v := range values {
+		if v == s {
+			return v
+		}
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return v
+		}
+	}
+	return s
+}
+
+//Collision is a set of URLs with IDs or aliases that are the same ignoring case
+type Collision struct {
+	ID   string   `json:"id"`
+	URLs []string `json:"urls"`
+}
+
+//Collisions returns the sets of URLs with IDs or aliases that are the same ignoring case, or an error if one occurred.
+//When IDs are case-insensitive, these can only be reached by their exact IDs
+func (d *DB) Collisions() ([]*Collision, error) {
+	collisions := make([]*Collision, 0)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		ib := tx.Bucket(foldedBucket)
+		if ib == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, foldedBucket)
+		}
+
+		return ib.ForEach(func(k, v []byte) error {
+			ids, err := indexIDs(tx, foldedBucket, string(k))
+			if err != nil {
+				return err
+			}
+			if len(ids) > 1 {
+				sort.Strings(ids)
+				collisions = append(collisions, &Collision{ID: string(k), URLs: ids})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find ID collisions: %v", err)
+	}
+
+	return collisions, nil
+}
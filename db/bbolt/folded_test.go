@@ -0,0 +1,104 @@
+package bbolt
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+func TestCaseInsensitiveEntryPoints(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer d.Close()
+
+	//legacy URLs from before IDs were case-insensitive
+	if _, err = d.Put(&db.URL{ID: "Docs", URL: "https://example.com/old-docs"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Delete("Docs", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Put(&db.URL{ID: "docs", URL: "https://example.com/docs"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Put(&db.URL{ID: "Wiki", URL: "https://example.com/wiki"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.CaseInsensitiveIDs()
+
+	if _, err = d.Put(&db.URL{ID: "Handbook", URL: "https://example.com/handbook"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		do   func() error
+		err  string
+	}{
+		{"import lowercases ID and aliases", func() error {
+			return d.Import(&db.URL{ID: "Guide", URL: "https://example.com/guide", User: "alice", Aliases: []string{"GD", "gd", "HANDBOOK"}})
+		}, ""},
+		{"import refuses other case of ID", func() error {
+			return d.Import(&db.URL{ID: "WIKI", URL: "https://example.com/other", User: "bob"})
+		}, "already exists"},
+		{"import refuses other case of alias", func() error {
+			return d.Import(&db.URL{ID: "Gd", URL: "https://example.com/other", User: "bob"})
+		}, "already exists"},
+		{"import refuses other case of reserved ID", func() error {
+			return d.Import(&db.URL{ID: "HEALTHZ", URL: "https://example.com/other", User: "bob"})
+		}, "is reserved"},
+		{"update other case", func() error {
+			return d.Update("HandBook", &db.URL{URL: "https://example.com/handbook2"}, "alice")
+		}, ""},
+		{"transfer other case", func() error { return d.Transfer("HANDBOOK", "bob", "admin") }, ""},
+		{"add alias other case", func() error { return d.AddAlias("GUIDE", "Manual") }, ""},
+		{"remove alias other case", func() error { return d.RemoveAlias("Guide", "GD") }, ""},
+		{"delete other case", func() error { return d.Delete("GuIdE", "alice") }, ""},
+		{"restore other case", func() error { return d.Restore("GUIDE", "carol") }, ""},
+		{"restore refuses other case of live URL", func() error { return d.Restore("Docs", "alice") }, "in use ignoring case"},
+		{"missing", func() error { return d.Delete("missing", "alice") }, "doesn't exist"},
+	}
+
+	for _, test := range tests {
+		err := test.do()
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.err, err)
+		}
+	}
+
+	url, err := d.Get("handbook")
+	if err != nil || url == nil {
+		t.Fatalf("Unable to get handbook: %v", err)
+	}
+	if url.ID != "handbook" || url.URL != "https://example.com/handbook2" || url.User != "bob" || url.ModifiedBy != "admin" {
+		t.Errorf("Expected handbook updated and transferred to bob by admin, got %s, %s, %s, %s", url.ID, url.URL, url.User, url.ModifiedBy)
+	}
+
+	url, err = d.Get("guide")
+	if err != nil || url == nil {
+		t.Fatalf("Unable to get guide: %v", err)
+	}
+	if url.ID != "guide" || len(url.Aliases) != 1 || url.Aliases[0] != "manual" || url.ModifiedBy != "carol" {
+		t.Errorf("Expected guide restored by carol with alias manual, got %s by %s with %v", url.ID, url.ModifiedBy, url.Aliases)
+	}
+
+	ids, err := d.getUserIDs("bob")
+	if err != nil || len(ids) != 1 || ids[0] != "handbook" {
+		t.Errorf("Expected bob to own handbook, got %v, %v", ids, err)
+	}
+
+	report, err := d.CheckRecords(false)
+	if err != nil {
+		t.Fatalf("Unable to check records: %v", err)
+	}
+	for _, p := range report.Problems {
+		t.Errorf("Unexpected problem: %s %s: %s", p.Type, p.ID, p.Error)
+	}
+}
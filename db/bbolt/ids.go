@@ -0,0 +1,138 @@
+package bbolt
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/korylprince/url-shortener-server/v2/idgen"
+	bolt "go.etcd.io/bbolt"
+)
+
+//growthKey is the metaBucket key for the number of times generated IDs have been made longer
+var growthKey = []byte("id_growth")
+
+//DefaultMaxAttempts is the default number of candidate IDs tried before Put gives up
+const DefaultMaxAttempts = 50
+
+//growAfter is the number of collisions in a row after which generated IDs are made longer
+const growAfter = 4
+
+//SetGenerator sets the generator used for new URL IDs, and the number of candidates tried
+//before Put returns an error. It should be called before the DB is used
+func (d *DB) SetGenerator(gen idgen.Generator, maxAttempts int) {
+	d.gen = gen
+	d.maxAttempts = maxAttempts
+}
+
+//getGrowth returns the stored ID growth
+func getGrowth(tx *bolt.Tx) (int, error) {
+	mb := tx.Bucket(metaBucket)
+	if mb == nil {
+		return 0, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, metaBucket)
+	}
+
+	v := mb.Get(growthKey)
+	if v == nil {
+		return 0, nil
+	}
+
+	grow, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf(`Unable to parse "%s" value "%s": %v`, growthKey, v, err)
+	}
+
+	return grow, nil
+}
+
+//putGrowth stores the ID growth
+func putGrowth(tx *bolt.Tx, grow int) error {
+	if err := tx.Bucket(metaBucket).Put(growthKey, []byte(strconv.Itoa(grow))); err != nil {
+		return fmt.Errorf(`Unable to put "%s" value: %v`, growthKey, err)
+	}
+	return nil
+}
+
+//idUsed returns true if id is used by a URL, deleted or not, or an alias, or an error if one occurred.
+//If IDs are case-insensitive, URLs and aliases matching id ignoring case are included
+func (d *DB) idUsed(tx *bolt.Tx, ub *bolt.Bucket, id string) (bool, error) {
+	if ub.Get([]byte(id)) != nil || aliasPrimary(tx, id) != "" {
+		return true, nil
+	}
+	return d.foldedUsed(tx, id)
+}
+
+//generateID returns an unused ID from the DB's generator, or an error if one couldn't be found.
+//Candidates that aren't clean are skipped. Random IDs are made longer after growAfter collisions in a row,
+//and the new length is kept for later IDs
+func (d *DB) generateID(tx *bolt.Tx, ub *bolt.Bucket) (string, error) {
+	grow, err := getGrowth(tx)
+	if err != nil {
+		return "", err
+	}
+
+	collisions := 0
+	for attempt := 0; attempt < d.maxAttempts; attempt++ {
+		var seq uint64
+		if d.gen.Sequential() {
+			if seq, err = ub.NextSequence(); err != nil {
+				return "", fmt.Errorf("Unable to get next ID sequence: %v", err)
+			}
+		}
+
+		id := d.gen.Generate(grow, seq)
+		if !idgen.Clean(id) {
+			continue
+		}
+
+		used, err := d.idUsed(tx, ub, id)
+		if err != nil {
+			return "", fmt.Errorf("Unable to check existing URL %s: %v", id, err)
+		}
+		if !used {
+			return id, nil
+		}
+
+		collisions++
+		if collisions >= growAfter && !d.gen.Sequential() {
+			grow++
+			collisions = 0
+			if err = putGrowth(tx, grow); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return "", fmt.Errorf("Unable to generate an unused URL ID after %d attempts: the ID space may be full", d.maxAttempts)
+}
+
+//Available returns true if id isn't used by a URL or alias, or an error if one occurred.
+//IDs of deleted URLs are available. If IDs are case-insensitive, id is checked as it would be saved
+func (d *DB) Available(id string) (bool, error) {
+	id = d.normalizeID(id)
+
+	available := false
+	err := d.db.View(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(urlsBucket)
+		if ub == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+		}
+
+		rec, err := getURL(ub, id)
+		if err != nil {
+			return err
+		}
+
+		if (rec != nil && !rec.Deleted) || aliasPrimary(tx, id) != "" {
+			return nil
+		}
+
+		used, err := d.foldedUsed(tx, id)
+		available = !used
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf(`Unable to check URL ID "%s": %v`, id, err)
+	}
+
+	return available, nil
+}
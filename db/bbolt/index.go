@@ -0,0 +1,189 @@
+package bbolt
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//Indexes map keys to sets of URL IDs. Each key is a nested bucket in the index bucket, with an empty value for each ID
+
+//urlIndexes are the indexes of non-deleted URLs and the function returning each URL's keys
+var urlIndexes = []struct {
+	name []byte
+	keys func(url *db.URL) []string
+}{
+	{tagsBucket, func(url *db.URL) []string { return url.Tags }},
+	{searchBucket, searchKeys},
+	{destinationsBucket, destinationKeys},
+	{foldedBucket, foldedKeys},
+}
+
+//updateURLIndexes moves id from the keys of old to the keys of new in each of urlIndexes.
+//old is nil for new or restored URLs and new is nil for deleted URLs
+func updateURLIndexes(tx *bolt.Tx, id string, old, new *db.URL) error {
+	for _, idx := range urlIndexes {
+		var oldKeys, newKeys []string
+		if old != nil {
+			oldKeys = idx.keys(old)
+		}
+		if new != nil {
+			newKeys = idx.keys(new)
+		}
+		if err := updateIndex(tx, idx.name, id, oldKeys, newKeys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//updateIndex moves id from the keys in old to the keys in new in the given index bucket. Empty keys are removed
+func updateIndex(tx *bolt.Tx, name []byte, id string, old, new []string) error {
+	ib := tx.Bucket(name)
+	if ib == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, name)
+	}
+
+	keep := make(map[string]bool)
+	for _, k := range new {
+		keep[k] = true
+	}
+
+	for _, k := range old {
+		if keep[k] {
+			continue
+		}
+		b := ib.Bucket([]byte(k))
+		if b == nil {
+			continue
+		}
+		if err := b.Delete([]byte(id)); err != nil {
+			return fmt.Errorf(`Unable to remove url "%s" from %s "%s": %v`, id, name, k, err)
+		}
+		if first, _ := b.Cursor().First(); first == nil {
+			if err := ib.DeleteBucket([]byte(k)); err != nil {
+				return fmt.Errorf(`Unable to remove %s "%s" bucket: %v`, name, k, err)
+			}
+		}
+	}
+
+	for k := range keep {
+		b, err := ib.CreateBucketIfNotExists([]byte(k))
+		if err != nil {
+			return fmt.Errorf(`Unable to create %s "%s" bucket: %v`, name, k, err)
+		}
+		if err = b.Put([]byte(id), nil); err != nil {
+			return fmt.Errorf(`Unable to add url "%s" to %s "%s": %v`, id, name, k, err)
+		}
+	}
+
+	return nil
+}
+
+//indexIDs returns the IDs for key in the given index bucket
+func indexIDs(tx *bolt.Tx, name []byte, key string) ([]string, error) {
+	ib := tx.Bucket(name)
+	if ib == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, name)
+	}
+
+	b := ib.Bucket([]byte(key))
+	if b == nil {
+		return nil, nil
+	}
+
+	var ids []string
+	err := b.ForEach(func(k, v []byte) error {
+		ids = append(ids, string(k))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to read %s "%s": %v`, name, key, err)
+	}
+
+	return ids, nil
+}
+
+//checkIndex compares the given index bucket to expected, a map of key to IDs, and returns a problem for each
+//missing or stale entry. If repair is true, the index is rebuilt from expected
+func checkIndex(tx *bolt.Tx, name []byte, expected map[string][]string, repair bool) ([]*Problem, error) {
+	ib := tx.Bucket(name)
+	if ib == nil {
+		return nil, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, name)
+	}
+
+	want := make(map[string]map[string]bool)
+	for k, ids := range expected {
+		want[k] = make(map[string]bool)
+		for _, id := range ids {
+			want[k][id] = true
+		}
+	}
+
+	var problems []*Problem
+	seen := make(map[string]map[string]bool)
+	err := ib.ForEach(func(k, v []byte) error {
+		key := string(k)
+		seen[key] = make(map[string]bool)
+		b := ib.Bucket(k)
+		if b == nil {
+			problems = append(problems, &Problem{Type: ProblemOrphaned, Error: fmt.Sprintf(`%s "%s" isn't a bucket`, name, key)})
+			return nil
+		}
+		return b.ForEach(func(id, v []byte) error {
+			seen[key][string(id)] = true
+			if !want[key][string(id)] {
+				problems = append(problems, &Problem{Type: ProblemOrphaned, ID: string(id), Error: fmt.Sprintf(`stale %s "%s" entry`, name, key)})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to read "%s" bucket: %v`, name, err)
+	}
+
+	keys := make([]string, 0, len(want))
+	for k := range want {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ids := make([]string, 0, len(want[k]))
+		for id := range want[k] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if !seen[k][id] {
+				problems = append(problems, &Problem{Type: ProblemMissing, ID: id, Error: fmt.Sprintf(`URL is missing from %s "%s"`, name, k)})
+			}
+		}
+	}
+
+	if !repair || len(problems) == 0 {
+		return problems, nil
+	}
+
+	if err = tx.DeleteBucket(name); err != nil {
+		return nil, fmt.Errorf(`Unable to remove "%s" bucket: %v`, name, err)
+	}
+	if _, err = tx.CreateBucket(name); err != nil {
+		return nil, fmt.Errorf(`Unable to create "%s" bucket: %v`, name, err)
+	}
+	for k, ids := range expected {
+		for _, id := range ids {
+			if err = updateIndex(tx, name, id, nil, []string{k}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, p := range problems {
+		p.Repaired = true
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,159 @@
+package bbolt
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//compactTxMaxSize is the maximum size of a transaction used when compacting
+const compactTxMaxSize = 64 << 20
+
+//Close stops any background tasks, flushes batched views, and closes the database
+func (d *DB) Close() error {
+	close(d.done)
+	d.wg.Wait()
+
+	if d.views != nil {
+		if err := d.flushViews(); err != nil {
+			log.Println("WARNING: Unable to flush views:", err)
+		}
+	}
+
+	return d.db.Close()
+}
+
+//Path returns the path of the database file
+func (d *DB) Path() string {
+	return d.db.Path()
+}
+
+//Ping returns an error if a read transaction can't be opened
+func (d *DB) Ping() error {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	if err = tx.Rollback(); err != nil {
+		return fmt.Errorf("Unable to rollback read-only transaction: %v", err)
+	}
+
+	return nil
+}
+
+//Stats returns the underlying bolt database statistics
+func (d *DB) Stats() bolt.Stats {
+	return d.db.Stats()
+}
+
+//Size returns the size of the database file in bytes or an error if one occurred
+func (d *DB) Size() (int64, error) {
+	fi, err := os.Stat(d.db.Path())
+	if err != nil {
+		return 0, fmt.Errorf("Unable to stat database: %v", err)
+	}
+	return fi.Size(), nil
+}
+
+//Count returns the number of URLs that aren't deleted or an error if one occurred.
+//Records that can't be decoded aren't counted
+func (d *DB) Count() (count int, err error) {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	defer func() {
+		if rErr := tx.Rollback(); rErr != nil && err == nil {
+			err = fmt.Errorf("Unable to rollback read-only transaction: %v", rErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return 0, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	err = ub.ForEach(func(k, v []byte) error {
+		if rec, err := getURL(ub, string(k)); err == nil && rec != nil && !rec.Deleted {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read URLs: %v", err)
+	}
+
+	return count, nil
+}
+
+//Check runs a consistency check of the database file and returns any errors found,
+//or an error if the check could not be run
+func (d *DB) Check() (errs []error, err error) {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	defer func() {
+		if rErr := tx.Rollback(); rErr != nil && err == nil {
+			err = fmt.Errorf("Unable to rollback read-only transaction: %v", rErr)
+		}
+	}()
+
+	for cErr := range tx.Check() {
+		errs = append(errs, cErr)
+	}
+
+	return errs, nil
+}
+
+//Backup writes a consistent snapshot of the database to w and returns the number of bytes written,
+//or an error if one occurred
+func (d *DB) Backup(w io.Writer) (n int64, err error) {
+	tx, err := d.db.Begin(false)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	defer func() {
+		if rErr := tx.Rollback(); rErr != nil && err == nil {
+			err = fmt.Errorf("Unable to rollback read-only transaction: %v", rErr)
+		}
+	}()
+
+	n, err = tx.WriteTo(w)
+	if err != nil {
+		return n, fmt.Errorf("Unable to write database: %v", err)
+	}
+
+	return n, nil
+}
+
+//Compact writes a compacted copy of the database to the given path, which must not exist,
+//or returns an error if one occurred
+func (d *DB) Compact(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("Unable to compact database: %s already exists", path)
+	}
+
+	dst, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return fmt.Errorf("Unable to create database %s: %v", path, err)
+	}
+
+	if err = bolt.Compact(dst, d.db, compactTxMaxSize); err != nil {
+		dst.Close()
+		return fmt.Errorf("Unable to compact database: %v", err)
+	}
+
+	if err = dst.Close(); err != nil {
+		return fmt.Errorf("Unable to close database %s: %v", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package bbolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+var metaBucket = []byte("meta")
+var versionKey = []byte("version")
+
+//migration migrates the database schema from one version to the next inside the given transaction
+type migration struct {
+	description string
+	migrate     func(tx *bolt.Tx) error
+}
+
+//migrations[i] migrates the database from schema version i to version i+1
+var migrations = []migration{
+	{"store each URL as a single encoded value", migrateEncodedRecords},
+	{"backfill created time and creator from last modified time and owner", migrateCreated},
+	{"mark existing view counts and expirations as notified", migrateNotified},
+	{"build search index", migrateIndex(searchBucket, searchKeys)},
+	{"build destinations index", migrateIndex(destinationsBucket, destinationKeys)},
+	{"build case-insensitive ID index", migrateIndex(foldedBucket, foldedKeys)},
+	{"build webhook delivery schedule and count delivery log", migrateDeliveries},
+}
+
+//SchemaVersion is the database schema version supported by this package
+var SchemaVersion = len(migrations)
+
+//version 0 layout keys
+var legacyUserKey = []byte("user")
+var legacyURLKey = []byte("url")
+var legacyViewsKey = []byte("views")
+var legacyExpiresKey = []byte("expires")
+var legacyDeletedKey = []byte("deleted")
+var legacyModifiedKey = []byte("modified")
+
+//legacyURL reads a URL stored in the version 0 layout of one bucket per URL with a key per field.
+//Missing or invalid views, expires, and modified values are replaced with defaults
+func legacyURL(id string, b *bolt.Bucket) *record {
+	rec := &record{Deleted: b.Get(legacyDeletedKey) != nil}
+	rec.ID = id
+	rec.User = string(b.Get(legacyUserKey))
+	rec.URL.URL = string(b.Get(legacyURLKey))
+
+	if views, read := binary.Uvarint(b.Get(legacyViewsKey)); read > 0 {
+		rec.Views = views
+	}
+
+	if bExpires := b.Get(legacyExpiresKey); bExpires != nil {
+		expires := new(time.Time)
+		if err := expires.UnmarshalBinary(bExpires); err == nil {
+			rec.Expires = expires
+		}
+	}
+
+	modified := new(time.Time)
+	if err := modified.UnmarshalBinary(b.Get(legacyModifiedKey)); err != nil {
+		*modified = time.Now()
+	}
+	rec.LastModified = modified
+
+	return rec
+}
+
+//convertLegacyURL replaces the version 0 bucket for the given id with an encoded record
+func convertLegacyURL(ub *bolt.Bucket, id string) error {
+	rec := legacyURL(id, ub.Bucket([]byte(id)))
+
+	if err := ub.DeleteBucket([]byte(id)); err != nil {
+		return fmt.Errorf(`Unable to delete url "%s" bucket: %v`, id, err)
+	}
+
+	if err := putURL(ub, rec); err != nil {
+		return fmt.Errorf(`Unable to put url "%s": %v`, id, err)
+	}
+
+	return nil
+}
+
+//migrateEncodedRecords converts each URL from a bucket with a key per field to a single encoded value
+func migrateEncodedRecords(tx *bolt.Tx) error {
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return nil
+	}
+
+	var ids []string
+	err := ub.ForEach(func(k, v []byte) error {
+		if v == nil {
+			ids = append(ids, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to read URL IDs: %v", err)
+	}
+
+	for _, id := range ids {
+		if err = convertLegacyURL(ub, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//migrateCreated sets Created and CreatedBy for URLs created before they were recorded
+func migrateCreated(tx *bolt.Tx) error {
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return nil
+	}
+
+	var recs []*record
+	err := ub.ForEach(func(k, v []byte) error {
+		rec, err := getURL(ub, string(k))
+		if err != nil {
+			//leave corrupt records for CheckRecords to report
+			log.Printf("WARNING: Unable to migrate URL \"%s\": %v\n", k, err)
+			return nil
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to read URLs: %v", err)
+	}
+
+	for _, rec := range recs {
+		if rec.Created == nil {
+			rec.Created = rec.LastModified
+		}
+		if rec.CreatedBy == "" {
+			rec.CreatedBy = rec.User
+		}
+		if err = putURL(ub, rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//migrateNotified marks existing view counts and expirations as notified
+//so webhooks aren't sent for events that happened before they existed
+func migrateNotified(tx *bolt.Tx) error {
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return nil
+	}
+
+	var recs []*record
+	err := ub.ForEach(func(k, v []byte) error {
+		rec, err := getURL(ub, string(k))
+		if err != nil {
+			//leave corrupt records for CheckRecords to report
+			log.Printf("WARNING: Unable to migrate URL \"%s\": %v\n", k, err)
+			return nil
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to read URLs: %v", err)
+	}
+
+	now := time.Now()
+	for _, rec := range recs {
+		rec.ViewsNotified = rec.Views
+		rec.ExpiryNotified = rec.Expires != nil && now.After(*(rec.Expires))
+		if err = putURL(ub, rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//migrateDeliveries adds queued deliveries to the schedule index and records the number of logged deliveries
+func migrateDeliveries(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucketIfNotExists(scheduleBucket); err != nil {
+		return fmt.Errorf(`Unable to create "%s" bucket: %v`, scheduleBucket, err)
+	}
+
+	if qb := tx.Bucket(queueBucket); qb != nil {
+		var deliveries []*db.Delivery
+		err := qb.ForEach(func(k, v []byte) error {
+			delivery := new(db.Delivery)
+			if err := json.Unmarshal(v, delivery); err != nil {
+				//corrupt deliveries are never due
+				log.Printf("WARNING: Unable to migrate delivery %d: %v\n", binary.BigEndian.Uint64(k), err)
+				return nil
+			}
+			deliveries = append(deliveries, delivery)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to read delivery queue: %v", err)
+		}
+
+		for _, delivery := range deliveries {
+			if err = schedule(tx, delivery); err != nil {
+				return err
+			}
+		}
+	}
+
+	if lb := tx.Bucket(deliveriesBucket); lb != nil {
+		if err := lb.SetSequence(uint64(lb.Stats().KeyN)); err != nil {
+			return fmt.Errorf("Unable to update delivery log count: %v", err)
+		}
+	}
+
+	return nil
+}
+
+//migrateIndex returns a migration that creates the given index and adds existing URLs to it with their keys
+func migrateIndex(name []byte, keys func(url *db.URL) []string) func(tx *bolt.Tx) error {
+	return func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return fmt.Errorf(`Unable to create "%s" bucket: %v`, name, err)
+		}
+		return indexURLs(tx, name, keys)
+	}
+}
+
+//indexURLs adds non-deleted URLs to the given index with their keys
+func indexURLs(tx *bolt.Tx, name []byte, keys func(url *db.URL) []string) error {
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return nil
+	}
+
+	var recs []*record
+	err := ub.ForEach(func(k, v []byte) error {
+		rec, err := getURL(ub, string(k))
+		if err != nil {
+			//leave corrupt records for CheckRecords to report
+			log.Printf("WARNING: Unable to migrate URL \"%s\": %v\n", k, err)
+			return nil
+		}
+		if rec != nil && !rec.Deleted {
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to read URLs: %v", err)
+	}
+
+	for _, rec := range recs {
+		if err = updateIndex(tx, name, rec.ID, nil, keys(&rec.URL)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//schemaVersion returns the schema version stored in the meta bucket. If it doesn't exist, it's initialized
+//to the current version for new databases or 0 for databases created before versioning
+func (d *DB) schemaVersion() (version int, err error) {
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	fresh := tx.Bucket(urlsBucket) == nil
+
+	mb, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return 0, fmt.Errorf(`Unable to create "%s" bucket: %v`, metaBucket, err)
+	}
+
+	if bVersion := mb.Get(versionKey); bVersion != nil {
+		version, err = strconv.Atoi(string(bVersion))
+		if err != nil {
+			return 0, fmt.Errorf(`Unable to parse "%s" value "%s": %v`, versionKey, bVersion, err)
+		}
+		return version, nil
+	}
+
+	if fresh {
+		version = SchemaVersion
+	}
+
+	if err = mb.Put(versionKey, []byte(strconv.Itoa(version))); err != nil {
+		return 0, fmt.Errorf(`Unable to put "%s" value: %v`, versionKey, err)
+	}
+
+	return version, nil
+}
+
+//migrate upgrades the database to SchemaVersion, backing it up first. Databases from newer versions are refused
+func (d *DB) migrate() error {
+	version, err := d.schemaVersion()
+	if err != nil {
+		return fmt.Errorf("Unable to get schema version: %v", err)
+	}
+
+	if version > SchemaVersion {
+		return fmt.Errorf("Database schema version %d is newer than supported version %d; upgrade the server", version, SchemaVersion)
+	}
+
+	if version == SchemaVersion {
+		return nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", d.db.Path(), version)
+	err = d.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backup, 0600)
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to backup database to %s before migration: %v", backup, err)
+	}
+	log.Printf("Backed up database to %s before migration\n", backup)
+
+	for ; version < SchemaVersion; version++ {
+		m := migrations[version]
+
+		err = d.db.Update(func(tx *bolt.Tx) error {
+			if err := m.migrate(tx); err != nil {
+				return err
+			}
+			return tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(version+1)))
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to migrate database to version %d (%s): %v", version+1, m.description, err)
+		}
+
+		log.Printf("Migrated database to version %d: %s\n", version+1, m.description)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package bbolt
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//legacyFixture is a URL stored in the version 0 layout
+type legacyFixture struct {
+	id       string
+	user     string
+	url      string
+	views    uint64
+	expires  *time.Time
+	modified time.Time
+	deleted  bool
+}
+
+//writeLegacyDB writes a database in the version 0 layout, before schema versions were recorded
+func writeLegacyDB(t *testing.T, path string, fixtures []legacyFixture) {
+	t.Helper()
+
+	ldb, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer ldb.Close()
+
+	err = ldb.Update(func(tx *bolt.Tx) error {
+		ub, err := tx.CreateBucket(urlsBucket)
+		if err != nil {
+			return err
+		}
+		users, err := tx.CreateBucket(usersBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range fixtures {
+			b, err := ub.CreateBucket([]byte(f.id))
+			if err != nil {
+				return err
+			}
+
+			views := make([]byte, binary.MaxVarintLen64)
+			views = views[:binary.PutUvarint(views, f.views)]
+			modified, err := f.modified.MarshalBinary()
+			if err != nil {
+				return err
+			}
+
+			values := map[string][]byte{
+				string(legacyUserKey):     []byte(f.user),
+				string(legacyURLKey):      []byte(f.url),
+				string(legacyViewsKey):    views,
+				string(legacyModifiedKey): modified,
+			}
+			if f.expires != nil {
+				if values[string(legacyExpiresKey)], err = f.expires.MarshalBinary(); err != nil {
+					return err
+				}
+			}
+			if f.deleted {
+				values[string(legacyDeletedKey)] = []byte{1}
+			}
+			for k, v := range values {
+				if err = b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+
+			u, err := users.CreateBucketIfNotExists([]byte(f.user))
+			if err != nil {
+				return err
+			}
+			if err = u.Put([]byte(f.id), nil); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to write legacy database: %v", err)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	modified := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	expired := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	fixtures := []legacyFixture{
+		{id: "Handbook", user: "alice", url: "https://example.com/handbook", views: 42, modified: modified},
+		{id: "old", user: "alice", url: "https://example.com/old", views: 3, expires: &expired, modified: modified},
+		{id: "soon", user: "bob", url: "https://Example.com:443/soon", expires: &expires, modified: modified},
+		{id: "gone", user: "bob", url: "https://example.com/gone", views: 7, modified: modified, deleted: true},
+	}
+
+	path := filepath.Join(t.TempDir(), "urls.db")
+	writeLegacyDB(t, path, fixtures)
+
+	d, err := New(path, 6)
+	if err != nil {
+		t.Fatalf("Unable to open legacy database: %v", err)
+	}
+	defer d.Close()
+
+	if _, err = os.Stat(path + ".v0.bak"); err != nil {
+		t.Errorf("Expected backup before migration: %v", err)
+	}
+
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if v := string(tx.Bucket(metaBucket).Get(versionKey)); v != strconv.Itoa(SchemaVersion) {
+			t.Errorf("Expected schema version %d, got %s", SchemaVersion, v)
+		}
+
+		ub := tx.Bucket(urlsBucket)
+		for _, f := range fixtures {
+			if ub.Bucket([]byte(f.id)) != nil {
+				t.Errorf("%s: still stored in the legacy layout", f.id)
+				continue
+			}
+
+			rec, err := getURL(ub, f.id)
+			if err != nil || rec == nil {
+				t.Errorf("%s: unable to read migrated record: %v", f.id, err)
+				continue
+			}
+
+			if rec.User != f.user || rec.URL.URL != f.url || rec.Views != f.views || rec.Deleted != f.deleted {
+				t.Errorf("%s: expected user %s, url %s, %d views, deleted %t; got %s, %s, %d, %t",
+					f.id, f.user, f.url, f.views, f.deleted, rec.User, rec.URL.URL, rec.Views, rec.Deleted)
+			}
+			if (rec.Expires == nil) != (f.expires == nil) || (rec.Expires != nil && !rec.Expires.Equal(*f.expires)) {
+				t.Errorf("%s: expected expires %v, got %v", f.id, f.expires, rec.Expires)
+			}
+			if rec.LastModified == nil || !rec.LastModified.Equal(f.modified) {
+				t.Errorf("%s: expected last modified %v, got %v", f.id, f.modified, rec.LastModified)
+			}
+			if rec.Created == nil || !rec.Created.Equal(f.modified) || rec.CreatedBy != f.user {
+				t.Errorf("%s: expected created %v by %s, got %v by %s", f.id, f.modified, f.user, rec.Created, rec.CreatedBy)
+			}
+			if rec.ViewsNotified != f.views {
+				t.Errorf("%s: expected %d views notified, got %d", f.id, f.views, rec.ViewsNotified)
+			}
+			if want := f.expires == &expired; rec.ExpiryNotified != want {
+				t.Errorf("%s: expected expiry notified %t, got %t", f.id, want, rec.ExpiryNotified)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.CheckRecords(false)
+	if err != nil {
+		t.Fatalf("Unable to check records: %v", err)
+	}
+	for _, p := range report.Problems {
+		t.Errorf("Unexpected problem after migration: %s %s: %s", p.Type, p.ID, p.Error)
+	}
+
+	results, err := d.Search("", "handbook", 0)
+	if err != nil || len(results) != 1 || results[0].ID != "Handbook" {
+		t.Errorf("Expected search to find Handbook, got %v, %v", results, err)
+	}
+
+	urls, err := d.DestinationURLs("", "https://example.com/soon")
+	if err != nil || len(urls) != 1 || urls[0].ID != "soon" {
+		t.Errorf("Expected destination index to find soon, got %v, %v", urls, err)
+	}
+
+	d.CaseInsensitiveIDs()
+	if url, err := d.Get("handbook"); err != nil || url == nil || url.ID != "Handbook" {
+		t.Errorf("Expected case-insensitive lookup to find Handbook, got %v, %v", url, err)
+	}
+	if url, err := d.Get("gone"); err != nil || url != nil {
+		t.Errorf("Expected deleted URL to stay deleted, got %v, %v", url, err)
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.db")
+
+	d, err := New(path, 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(SchemaVersion+1)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	if d, err = New(path, 6); err == nil {
+		d.Close()
+		t.Fatal("Expected database from a newer version to be refused")
+	}
+}
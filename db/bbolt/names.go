@@ -0,0 +1,40 @@
+package bbolt
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var displayNamesBucket = []byte("display_names")
+
+//DisplayName returns the display name for the given user, or an empty string if it isn't known, or an error if one occurred
+func (d *DB) DisplayName(user string) (name string, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		nb := tx.Bucket(displayNamesBucket)
+		if nb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, displayNamesBucket)
+		}
+
+		name = string(nb.Get([]byte(user)))
+		return nil
+	})
+
+	return name, err
+}
+
+//SetDisplayName sets the display name for the given user or returns an error if one occurred
+func (d *DB) SetDisplayName(user, name string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		nb := tx.Bucket(displayNamesBucket)
+		if nb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, displayNamesBucket)
+		}
+
+		if err := nb.Put([]byte(user), []byte(name)); err != nil {
+			return fmt.Errorf(`Unable to put display name for user "%s": %v`, user, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,285 @@
+package bbolt
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//searchBucket is an index of "<field>:<token>" keys to URL IDs
+var searchBucket = []byte("search")
+
+//searchFields are the indexed fields and their weights when ranking results
+var searchFields = []struct {
+	name   string
+	weight float64
+}{
+	{"id", 10},
+	{"title", 6},
+	{"user", 5},
+	{"host", 4},
+	{"tag", 3},
+	{"path", 2},
+}
+
+//maxTokenLength is the length of the longest indexed token. Longer tokens are skipped
+const maxTokenLength = 64
+
+//prefixScore and fuzzyScore are the fractions of a field's weight given to prefix and fuzzy matches
+const (
+	prefixScore = 0.5
+	fuzzyScore  = 0.25
+)
+
+//searchTokens splits s into lowercase tokens of letters and numbers
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+//searchKeys returns the search index keys for url
+func searchKeys(url *db.URL) []string {
+	set := make(map[string]bool)
+	add := func(field string, tokens []string, minLength int) {
+		for _, t := range tokens {
+			if len(t) >= minLength && len(t) <= maxTokenLength {
+				set[field+":"+t] = true
+			}
+		}
+	}
+
+	for _, id := range append([]string{url.ID}, url.Aliases...) {
+		id = strings.ToLower(id)
+		add("id", append(searchTokens(id), id), 1)
+	}
+	add("title", searchTokens(url.Title), 2)
+	user := strings.ToLower(url.User)
+	add("user", append(searchTokens(user), user), 1)
+	add("tag", url.Tags, 1)
+
+	if u, err := neturl.Parse(url.URL); err == nil {
+		host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		add("host", append(searchTokens(host), host), 2)
+		add("path", searchTokens(u.Path), 2)
+	}
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+//maxDistance returns the edit distance allowed for fuzzy matches of term
+func maxDistance(term string) int {
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+//distance returns the edit distance between a and b, counting insertions, deletions, substitutions,
+//and swaps of adjacent characters, or max+1 if it's greater than max
+func distance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra)-len(rb) > max || len(rb)-len(ra) > max {
+		return max + 1
+	}
+
+	//rows i-2, i-1, and i of the distance matrix
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if v := prev[j] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if v := cur[j-1] + 1; v < cur[j] {
+				cur[j] = v
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if v := prev2[j-2] + 1; v < cur[j] {
+					cur[j] = v
+				}
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+//matchScore returns the score of token matching term, or 0 if it doesn't match
+func matchScore(term, token string) float64 {
+	switch {
+	case token == term:
+		return 1
+	case strings.HasPrefix(token, term):
+		return prefixScore
+	}
+
+	max := maxDistance(term)
+	if max == 0 {
+		return 0
+	}
+	if dist := distance(term, token, max); dist <= max {
+		return fuzzyScore / float64(dist)
+	}
+
+	return 0
+}
+
+//searchTerm returns the score of each URL ID matching term in the search index bucket sb.
+//Each field adds its weight multiplied by its best match for the term
+func searchTerm(sb *bolt.Bucket, term string) (map[string]float64, error) {
+	scores := make(map[string]float64)
+	for _, field := range searchFields {
+		prefix := []byte(field.name + ":")
+
+		//only fuzzy matches need to scan the whole field
+		seek := append(append([]byte{}, prefix...), term...)
+		if maxDistance(term) > 0 {
+			seek = prefix
+		}
+
+		best := make(map[string]float64)
+		c := sb.Cursor()
+		for k, _ := c.Seek(seek); k != nil && bytes.HasPrefix(k, seek); k, _ = c.Next() {
+			score := matchScore(term, string(k[len(prefix):]))
+			if score == 0 {
+				continue
+			}
+
+			b := sb.Bucket(k)
+			if b == nil {
+				continue
+			}
+			err := b.ForEach(func(id, v []byte) error {
+				if score > best[string(id)] {
+					best[string(id)] = score
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf(`Unable to read %s "%s": %v`, searchBucket, k, err)
+			}
+		}
+
+		for id, score := range best {
+			scores[id] += field.weight * score
+		}
+	}
+
+	return scores, nil
+}
+
+//Search returns up to limit URLs matching query for the given user, or all users if user is empty,
+//ranked from best to worst match, or an error if one occurred. Every word in query must match an ID, title,
+//owner, destination host, tag, or destination path token exactly, by prefix, or within a small edit distance
+func (d *DB) Search(user, query string, limit int) ([]*db.SearchResult, error) {
+	terms := searchTokens(query)
+	if len(terms) == 0 {
+		return make([]*db.SearchResult, 0), nil
+	}
+
+	var results []*db.SearchResult
+	err := d.db.View(func(tx *bolt.Tx) error {
+		sb := tx.Bucket(searchBucket)
+		if sb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, searchBucket)
+		}
+
+		var total map[string]float64
+		for _, term := range terms {
+			scores, err := searchTerm(sb, term)
+			if err != nil {
+				return err
+			}
+
+			if total == nil {
+				total = scores
+				continue
+			}
+
+			for id := range total {
+				if score, ok := scores[id]; ok {
+					total[id] += score
+				} else {
+					delete(total, id)
+				}
+			}
+		}
+
+		for id, score := range total {
+			if userOwns(tx, user, id) {
+				results = append(results, &db.SearchResult{URL: &db.URL{ID: id}, Score: score})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to search URLs: %v", err)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	matched := make([]*db.SearchResult, 0, len(results))
+	for _, r := range results {
+		if limit > 0 && len(matched) >= limit {
+			break
+		}
+
+		url, err := d.Get(r.ID)
+		if err != nil {
+			log.Printf("WARNING: Unable to get URL \"%s\": %v\n", r.ID, err)
+			continue
+		}
+		//the URL may have changed since the index was read
+		if url == nil || (user != "" && url.User != user) {
+			continue
+		}
+
+		r.URL = url
+		matched = append(matched, r)
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,145 @@
+package bbolt
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const snapshotTimeFormat = "20060102T150405Z"
+
+//snapshotPrefix returns the file name prefix used for snapshots of the database
+func (d *DB) snapshotPrefix() string {
+	base := filepath.Base(d.db.Path())
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+//Snapshot writes a timestamped snapshot of the database to dir and verifies it,
+//then removes all but the newest retain snapshots in dir if retain is greater than zero.
+//The path of the snapshot and number of URLs in it are returned, or an error if one occurred
+func (d *DB) Snapshot(dir string, retain int) (path string, count int, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, fmt.Errorf("Unable to create snapshot directory %s: %v", dir, err)
+	}
+
+	prefix := d.snapshotPrefix()
+	path = filepath.Join(dir, prefix+time.Now().UTC().Format(snapshotTimeFormat)+".db")
+	tmp := path + ".partial"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", 0, fmt.Errorf("Unable to create snapshot file %s: %v", tmp, err)
+	}
+
+	_, err = d.Backup(f)
+	if sErr := f.Sync(); err == nil {
+		err = sErr
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", 0, fmt.Errorf("Unable to write snapshot %s: %v", tmp, err)
+	}
+
+	if count, err = Verify(tmp); err != nil {
+		os.Remove(tmp)
+		return "", 0, fmt.Errorf("Unable to verify snapshot %s: %v", tmp, err)
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", 0, fmt.Errorf("Unable to rename snapshot %s: %v", tmp, err)
+	}
+
+	if retain < 1 {
+		return path, count, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return path, count, fmt.Errorf("Unable to read snapshot directory %s: %v", dir, err)
+	}
+
+	var snapshots []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ".db") {
+			snapshots = append(snapshots, name)
+		}
+	}
+
+	//timestamps sort lexically
+	sort.Strings(snapshots)
+	for len(snapshots) > retain {
+		if err = os.Remove(filepath.Join(dir, snapshots[0])); err != nil {
+			return path, count, fmt.Errorf("Unable to remove old snapshot %s: %v", snapshots[0], err)
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return path, count, nil
+}
+
+//Verify opens the database at path read-only and returns the number of URLs in it,
+//or an error if one occurred
+func Verify(path string) (count int, err error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: openTimeout})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open database %s: %v", path, err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(false)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open database for reading: %v", err)
+	}
+
+	defer func() {
+		if rErr := tx.Rollback(); rErr != nil && err == nil {
+			err = fmt.Errorf("Unable to rollback read-only transaction: %v", rErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return 0, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	err = ub.ForEach(func(k, v []byte) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read URL IDs: %v", err)
+	}
+
+	return count, nil
+}
+
+//ScheduleSnapshots writes a snapshot to dir every interval, keeping the newest retain snapshots,
+//until the database is closed
+func (d *DB) ScheduleSnapshots(dir string, interval time.Duration, retain int) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-t.C:
+			path, count, err := d.Snapshot(dir, retain)
+			if err != nil {
+				log.Println("WARNING: Unable to write database snapshot:", err)
+				continue
+			}
+			log.Printf("Wrote database snapshot %s with %d URLs\n", path, count)
+		}
+	}
+}
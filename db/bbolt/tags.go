@@ -0,0 +1,83 @@
+package bbolt
+
+import (
+	"fmt"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+var tagsBucket = []byte("tags")
+
+//userOwns returns true if user is empty or the users index has id for user
+func userOwns(tx *bolt.Tx, user, id string) bool {
+	if user == "" {
+		return true
+	}
+	ub := tx.Bucket(usersBucket)
+	if ub == nil {
+		return false
+	}
+	b := ub.Bucket([]byte(user))
+	return b != nil && b.Get([]byte(id)) != nil
+}
+
+//TaggedURLs returns the URLs with the given tag for the given user, or all users if user is empty,
+//or an error if one occurred
+func (d *DB) TaggedURLs(user, tag string) ([]*db.URL, error) {
+	var ids []string
+	err := d.db.View(func(tx *bolt.Tx) error {
+		tagged, err := indexIDs(tx, tagsBucket, tag)
+		if err != nil {
+			return err
+		}
+		for _, id := range tagged {
+			if userOwns(tx, user, id) {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to get tag "%s" URL IDs: %v`, tag, err)
+	}
+
+	return d.getURLs(user, ids), nil
+}
+
+//Tags returns a map of tag to number of URLs for the given user, or all users if user is empty,
+//or an error if one occurred
+func (d *DB) Tags(user string) (map[string]int, error) {
+	tags := make(map[string]int)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		tb := tx.Bucket(tagsBucket)
+		if tb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, tagsBucket)
+		}
+
+		return tb.ForEach(func(k, v []byte) error {
+			b := tb.Bucket(k)
+			if b == nil {
+				return nil
+			}
+			n := 0
+			if err := b.ForEach(func(id, v []byte) error {
+				if userOwns(tx, user, string(id)) {
+					n++
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if n > 0 {
+				tags[string(k)] = n
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read tags: %v", err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,31 @@
+package bbolt
+
+import (
+	"fmt"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//SetUnfurl sets the fetched Unfurl metadata for the URL with the given id without changing LastModified,
+//or returns an error if one occurred. Missing and deleted URLs are ignored
+func (d *DB) SetUnfurl(id string, unfurl *db.Unfurl) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(urlsBucket)
+		if ub == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+		}
+
+		rec, err := d.lookupID(tx, ub, id)
+		if err != nil {
+			return fmt.Errorf(`Unable to get URL "%s": %v`, id, err)
+		}
+		if rec == nil || rec.Deleted {
+			return nil
+		}
+
+		rec.Unfurl = unfurl
+
+		return putURL(ub, rec)
+	})
+}
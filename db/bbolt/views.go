@@ -0,0 +1,313 @@
+package bbolt
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//viewCounter accumulates view counts in memory until they're flushed to the database
+type viewCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+//add adds n views for id
+func (c *viewCounter) add(id string, n uint64) {
+	c.mu.Lock()
+	c.counts[id] += n
+	c.mu.Unlock()
+}
+
+//pending returns the views for id not yet flushed. It's safe to call on a nil *viewCounter
+func (c *viewCounter) pending(id string) uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[id]
+}
+
+//swap returns the accumulated counts and resets them
+func (c *viewCounter) swap() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.counts
+	c.counts = make(map[string]uint64)
+	return counts
+}
+
+//BatchViews enables batched view counting: View counts views in memory and they're written to the database
+//every interval and when the database is closed. Views not yet flushed are lost if the process crashes.
+//BatchViews must be called before the database is used
+func (d *DB) BatchViews(interval time.Duration) {
+	d.views = &viewCounter{counts: make(map[string]uint64)}
+	d.aliasViews = &viewCounter{counts: make(map[string]uint64)}
+	d.botViews = &viewCounter{counts: make(map[string]uint64)}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-t.C:
+				if err := d.flushViews(); err != nil {
+					log.Println("WARNING: Unable to flush views:", err)
+				}
+			}
+		}
+	}()
+}
+
+//Resolve returns the url with the given id, or an error if one occurred.
+//If a url with the given id doesn't exist, url will be empty, and if it's expired, err will be db.ErrExpired. Resolve doesn't count a view
+func (d *DB) Resolve(id string) (string, error) {
+	u, err := d.Get(id)
+	if err != nil {
+		return "", fmt.Errorf(`Unable to get url "%s": %v`, id, err)
+	}
+
+	//check exists
+	if u == nil {
+		return "", nil
+	}
+
+	//check expired
+	if u.Expires != nil && time.Now().After(*(u.Expires)) {
+		return "", db.ErrExpired
+	}
+
+	return u.URL, nil
+}
+
+//resolve returns the non-deleted record with the given id or alias and the alias, if one matched,
+//or an error if one occurred. If the record doesn't exist, rec will be nil
+func (d *DB) resolve(id string) (rec *record, alias string, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(urlsBucket)
+		if ub == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+		}
+
+		rec, alias, err = d.lookup(tx, ub, id)
+		return err
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf(`Unable to get url "%s": %v`, id, err)
+	}
+
+	if rec == nil || rec.Deleted {
+		return nil, "", nil
+	}
+
+	return rec, alias, nil
+}
+
+//batchView adds a batched view for the URL with the given canonical id, and alias if it was viewed through one.
+//Views are keyed by the URL's ID and the alias as stored so each URL has one pending count however its ID is typed
+func (d *DB) batchView(id, alias string) {
+	d.views.add(id, 1)
+	if alias != "" {
+		d.aliasViews.add(alias, 1)
+	}
+}
+
+//viewBatched is View for batched view counting
+func (d *DB) viewBatched(id string) (string, error) {
+	rec, alias, err := d.resolve(id)
+	if err != nil || rec == nil {
+		return "", err
+	}
+
+	//check expired
+	if rec.Expires != nil && time.Now().After(*(rec.Expires)) {
+		return "", db.ErrExpired
+	}
+
+	d.batchView(rec.ID, alias)
+
+	return rec.URL.URL, nil
+}
+
+//CountView increments the view counter for the URL with the given id or returns an error if one occurred.
+//Views for missing URLs are ignored
+func (d *DB) CountView(id string) error {
+	if d.views != nil {
+		rec, alias, err := d.resolve(id)
+		if err != nil || rec == nil {
+			return err
+		}
+		d.batchView(rec.ID, alias)
+		return nil
+	}
+
+	return d.countViews(id, 1, 0)
+}
+
+//CountBotView increments the bot view counter for the URL with the given id or returns an error if one occurred.
+//Views for missing URLs are ignored
+func (d *DB) CountBotView(id string) error {
+	if d.botViews != nil {
+		rec, _, err := d.resolve(id)
+		if err != nil || rec == nil {
+			return err
+		}
+		d.botViews.add(rec.ID, 1)
+		return nil
+	}
+
+	return d.countViews(id, 0, 1)
+}
+
+//countViews adds views and botViews to the URL with the given id in a single transaction
+func (d *DB) countViews(id string, views, botViews uint64) (err error) {
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	return d.addViews(tx, ub, id, views, botViews)
+}
+
+//flushViews writes accumulated views to the database in a single transaction.
+//If the transaction fails, the views are kept to be retried on the next flush
+func (d *DB) flushViews() (err error) {
+	counts := d.views.swap()
+	aliasCounts := d.aliasViews.swap()
+	botCounts := d.botViews.swap()
+	if len(counts) == 0 && len(botCounts) == 0 {
+		return nil
+	}
+
+	defer func() {
+		if err != nil {
+			for id, n := range counts {
+				d.views.add(id, n)
+			}
+			for alias, n := range aliasCounts {
+				d.aliasViews.add(alias, n)
+			}
+			for id, n := range botCounts {
+				d.botViews.add(id, n)
+			}
+		}
+	}()
+
+	tx, err := d.db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("Unable to open database for writing: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if rErr := tx.Rollback(); rErr != nil {
+				log.Println("WARNING: Unable to rollback failed transaction:", rErr)
+			}
+			return
+		}
+
+		if cErr := tx.Commit(); cErr != nil {
+			err = fmt.Errorf("Unable to commit transaction: %v", cErr)
+		}
+	}()
+
+	ub := tx.Bucket(urlsBucket)
+	if ub == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+	}
+
+	for id, n := range counts {
+		if err = d.addViews(tx, ub, id, n, botCounts[id]); err != nil {
+			return err
+		}
+	}
+
+	for id, n := range botCounts {
+		if _, ok := counts[id]; ok {
+			continue
+		}
+		if err = d.addViews(tx, ub, id, 0, n); err != nil {
+			return err
+		}
+	}
+
+	for alias, n := range aliasCounts {
+		if err = addAliasViews(tx, ub, alias, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//addAliasViews adds views to the breakdown for alias on the URL it belongs to. The views are already counted
+//in the URL's total. Views for aliases that have since been removed are dropped
+func addAliasViews(tx *bolt.Tx, ub *bolt.Bucket, alias string, views uint64) error {
+	rec, matched, err := getURLOrAlias(tx, ub, alias)
+	if err != nil {
+		log.Printf("WARNING: Dropping %d views for alias \"%s\": %v\n", views, alias, err)
+		return nil
+	}
+	if rec == nil || matched != alias {
+		return nil
+	}
+
+	if rec.AliasViews == nil {
+		rec.AliasViews = make(map[string]uint64)
+	}
+	rec.AliasViews[alias] += views
+
+	return putURL(ub, rec)
+}
+
+//addViews adds views and botViews to the URL with the given id or alias. Views for missing or corrupt URLs are dropped
+func (d *DB) addViews(tx *bolt.Tx, ub *bolt.Bucket, id string, views, botViews uint64) error {
+	rec, alias, err := d.lookup(tx, ub, id)
+	if err != nil {
+		log.Printf("WARNING: Dropping %d views and %d bot views for URL \"%s\": %v\n", views, botViews, id, err)
+		return nil
+	}
+	if rec == nil {
+		return nil
+	}
+
+	rec.Views += views
+	rec.BotViews += botViews
+	if alias != "" && views > 0 {
+		if rec.AliasViews == nil {
+			rec.AliasViews = make(map[string]uint64)
+		}
+		rec.AliasViews[alias] += views
+	}
+
+	return putURL(ub, rec)
+}
@@ -0,0 +1,94 @@
+package bbolt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+func TestBatchedViewsCanonicalID(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer d.Close()
+
+	d.CaseInsensitiveIDs()
+	d.BatchViews(time.Hour)
+
+	if _, err = d.Put(&db.URL{ID: "handbook", URL: "https://example.com"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.AddAlias("handbook", "hb"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"handbook", "Handbook", "HANDBOOK", "hb", "HB", "missing"} {
+		if _, err = d.View(id); err != nil {
+			t.Fatalf("Unable to view %s: %v", id, err)
+		}
+	}
+	if err = d.CountView("hB"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.CountBotView("HandBook"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := len(d.views.counts); ids != 1 {
+		t.Errorf("Expected pending views for 1 ID, got %d: %v", ids, d.views.counts)
+	}
+
+	check := func(when string) {
+		url, err := d.Get("handbook")
+		if err != nil || url == nil {
+			t.Fatalf("Unable to get URL: %v", err)
+		}
+		if url.Views != 6 || url.BotViews != 1 || url.AliasViews["hb"] != 3 {
+			t.Errorf("%s: expected 6 views, 1 bot view, and 3 alias views; got %d, %d, and %v",
+				when, url.Views, url.BotViews, url.AliasViews)
+		}
+	}
+
+	check("before flush")
+	if err = d.flushViews(); err != nil {
+		t.Fatalf("Unable to flush views: %v", err)
+	}
+	check("after flush")
+}
+
+func TestExpiredViews(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer d.Close()
+
+	expired := time.Now().Add(-time.Hour)
+	if err = d.Import(&db.URL{ID: "old", URL: "https://example.com", User: "alice", Expires: &expired}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, batch := range []bool{false, true} {
+		if batch {
+			d.BatchViews(time.Hour)
+		}
+		tests := []struct {
+			id      string
+			wantErr error
+		}{
+			{"old", db.ErrExpired},
+			{"missing", nil},
+		}
+		for _, test := range tests {
+			if url, err := d.View(test.id); url != "" || err != test.wantErr {
+				t.Errorf("batch %t: expected View(%s) to return \"\", %v; got %q, %v", batch, test.id, test.wantErr, url, err)
+			}
+			if url, err := d.Resolve(test.id); url != "" || err != test.wantErr {
+				t.Errorf("batch %t: expected Resolve(%s) to return \"\", %v; got %q, %v", batch, test.id, test.wantErr, url, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,507 @@
+package bbolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/rand"
+	bolt "go.etcd.io/bbolt"
+)
+
+//webhookIDLength is the length of generated webhook IDs
+const webhookIDLength = 8
+
+//maxDeliveryLog is the number of finished deliveries kept in the delivery log
+const maxDeliveryLog = 1000
+
+var webhooksBucket = []byte("webhooks")
+var queueBucket = []byte("webhook_queue")
+var deliveriesBucket = []byte("webhook_deliveries")
+
+//scheduleBucket indexes the queue by next attempt so Due only reads deliveries that are due
+var scheduleBucket = []byte("webhook_schedule")
+
+func deliveryKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+//scheduleKey returns the schedule index key for a delivery with the given id attempted at next.
+//Keys sort by next attempt, then by ID
+func scheduleKey(next time.Time, id uint64) []byte {
+	var nanos uint64
+	if next.After(time.Unix(0, 0)) {
+		nanos = uint64(next.UnixNano())
+	}
+
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, nanos)
+	binary.BigEndian.PutUint64(k[8:], id)
+	return k
+}
+
+//schedule adds delivery to the schedule index inside tx
+func schedule(tx *bolt.Tx, delivery *db.Delivery) error {
+	sb := tx.Bucket(scheduleBucket)
+	if sb == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, scheduleBucket)
+	}
+
+	if err := sb.Put(scheduleKey(delivery.NextAttempt, delivery.ID), nil); err != nil {
+		return fmt.Errorf("Unable to schedule delivery %d: %v", delivery.ID, err)
+	}
+
+	return nil
+}
+
+//unqueue removes the delivery with the given id from the queue and schedule index inside tx.
+//It returns false if the delivery isn't queued
+func unqueue(tx *bolt.Tx, id uint64) (bool, error) {
+	qb := tx.Bucket(queueBucket)
+	if qb == nil {
+		return false, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, queueBucket)
+	}
+
+	sb := tx.Bucket(scheduleBucket)
+	if sb == nil {
+		return false, fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, scheduleBucket)
+	}
+
+	v := qb.Get(deliveryKey(id))
+	if v == nil {
+		return false, nil
+	}
+
+	queued := new(db.Delivery)
+	if err := json.Unmarshal(v, queued); err != nil {
+		return false, fmt.Errorf("Unable to decode delivery %d: %v", id, err)
+	}
+
+	if err := sb.Delete(scheduleKey(queued.NextAttempt, id)); err != nil {
+		return false, fmt.Errorf("Unable to unschedule delivery %d: %v", id, err)
+	}
+
+	if err := qb.Delete(deliveryKey(id)); err != nil {
+		return false, fmt.Errorf("Unable to delete delivery %d from queue: %v", id, err)
+	}
+
+	return true, nil
+}
+
+func putDelivery(b *bolt.Bucket, delivery *db.Delivery) error {
+	buf, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("Unable to encode delivery %d: %v", delivery.ID, err)
+	}
+
+	if err = b.Put(deliveryKey(delivery.ID), buf); err != nil {
+		return fmt.Errorf("Unable to put delivery %d: %v", delivery.ID, err)
+	}
+
+	return nil
+}
+
+//enqueue adds deliveries to the queue inside tx
+func enqueue(tx *bolt.Tx, deliveries []*db.Delivery) error {
+	qb := tx.Bucket(queueBucket)
+	if qb == nil {
+		return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, queueBucket)
+	}
+
+	for _, delivery := range deliveries {
+		id, err := qb.NextSequence()
+		if err != nil {
+			return fmt.Errorf("Unable to get delivery ID: %v", err)
+		}
+		delivery.ID = id
+
+		if err = putDelivery(qb, delivery); err != nil {
+			return err
+		}
+
+		if err = schedule(tx, delivery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Webhooks returns all webhooks or an error if one occurred
+func (d *DB) Webhooks() ([]*db.Webhook, error) {
+	hooks := make([]*db.Webhook, 0)
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(webhooksBucket)
+		if wb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, webhooksBucket)
+		}
+
+		return wb.ForEach(func(k, v []byte) error {
+			hook := new(db.Webhook)
+			if err := json.Unmarshal(v, hook); err != nil {
+				return fmt.Errorf(`Unable to decode webhook "%s": %v`, k, err)
+			}
+			hooks = append(hooks, hook)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+//PutWebhook saves the given webhook, generating its ID if empty, or returns an error if one occurred
+func (d *DB) PutWebhook(hook *db.Webhook) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(webhooksBucket)
+		if wb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, webhooksBucket)
+		}
+
+		if hook.ID == "" {
+			for {
+				hook.ID = rand.String(webhookIDLength)
+				if wb.Get([]byte(hook.ID)) == nil {
+					break
+				}
+			}
+		}
+
+		buf, err := json.Marshal(hook)
+		if err != nil {
+			return fmt.Errorf(`Unable to encode webhook "%s": %v`, hook.ID, err)
+		}
+
+		if err = wb.Put([]byte(hook.ID), buf); err != nil {
+			return fmt.Errorf(`Unable to put webhook "%s": %v`, hook.ID, err)
+		}
+
+		return nil
+	})
+}
+
+//DeleteWebhook deletes the webhook with the given id and its pending deliveries
+//or returns an error if one occurred
+func (d *DB) DeleteWebhook(id string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(webhooksBucket)
+		if wb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, webhooksBucket)
+		}
+
+		if wb.Get([]byte(id)) == nil {
+			return fmt.Errorf(`Webhook "%s" doesn't exist`, id)
+		}
+
+		if err := wb.Delete([]byte(id)); err != nil {
+			return fmt.Errorf(`Unable to delete webhook "%s": %v`, id, err)
+		}
+
+		qb := tx.Bucket(queueBucket)
+		if qb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, queueBucket)
+		}
+
+		sb := tx.Bucket(scheduleBucket)
+		if sb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, scheduleBucket)
+		}
+
+		deleted := make(map[uint64]bool)
+		err := qb.ForEach(func(k, v []byte) error {
+			delivery := new(db.Delivery)
+			if err := json.Unmarshal(v, delivery); err != nil || delivery.WebhookID == id {
+				deleted[binary.BigEndian.Uint64(k)] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to read delivery queue: %v", err)
+		}
+
+		for did := range deleted {
+			if err = qb.Delete(deliveryKey(did)); err != nil {
+				return fmt.Errorf("Unable to delete delivery %d: %v", did, err)
+			}
+		}
+
+		//corrupt deliveries can't be decoded to find their schedule keys, so the index is scanned by ID
+		var keys [][]byte
+		err = sb.ForEach(func(k, v []byte) error {
+			if deleted[binary.BigEndian.Uint64(k[8:])] {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to read delivery schedule: %v", err)
+		}
+
+		for _, k := range keys {
+			if err = sb.Delete(k); err != nil {
+				return fmt.Errorf("Unable to unschedule delivery %d: %v", binary.BigEndian.Uint64(k[8:]), err)
+			}
+		}
+
+		return nil
+	})
+}
+
+//Enqueue adds the given deliveries to the queue, setting their IDs, or returns an error if one occurred
+func (d *DB) Enqueue(deliveries ...*db.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return enqueue(tx, deliveries)
+	})
+}
+
+//Due returns up to limit queued deliveries whose next attempt is at or before now, oldest first,
+//or an error if one occurred
+func (d *DB) Due(now time.Time, limit int) ([]*db.Delivery, error) {
+	var deliveries []*db.Delivery
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		qb := tx.Bucket(queueBucket)
+		if qb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, queueBucket)
+		}
+
+		sb := tx.Bucket(scheduleBucket)
+		if sb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, scheduleBucket)
+		}
+
+		//only deliveries scheduled at or before now are read
+		end := scheduleKey(now, math.MaxUint64)
+		c := sb.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) <= 0 && len(deliveries) < limit; k, _ = c.Next() {
+			id := binary.BigEndian.Uint64(k[8:])
+			v := qb.Get(deliveryKey(id))
+			if v == nil {
+				continue
+			}
+
+			delivery := new(db.Delivery)
+			if err := json.Unmarshal(v, delivery); err != nil {
+				return fmt.Errorf("Unable to decode delivery %d: %v", id, err)
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+//Requeue saves a queued delivery after a failed attempt or returns an error if one occurred
+func (d *DB) Requeue(delivery *db.Delivery) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		qb := tx.Bucket(queueBucket)
+		if qb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, queueBucket)
+		}
+
+		//the webhook may have been deleted during the attempt
+		if queued, err := unqueue(tx, delivery.ID); err != nil || !queued {
+			return err
+		}
+
+		if err := putDelivery(qb, delivery); err != nil {
+			return err
+		}
+
+		return schedule(tx, delivery)
+	})
+}
+
+//Finish removes a delivery from the queue and adds it to the delivery log, keeping only the newest
+//entries, or returns an error if one occurred
+func (d *DB) Finish(delivery *db.Delivery) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		lb := tx.Bucket(deliveriesBucket)
+		if lb == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, deliveriesBucket)
+		}
+
+		if _, err := unqueue(tx, delivery.ID); err != nil {
+			return err
+		}
+
+		//the log's sequence is its number of entries
+		count := lb.Sequence()
+		if lb.Get(deliveryKey(delivery.ID)) == nil {
+			count++
+		}
+
+		if err := putDelivery(lb, delivery); err != nil {
+			return err
+		}
+
+		//trim oldest entries
+		c := lb.Cursor()
+		for ; count > maxDeliveryLog; count-- {
+			if k, _ := c.First(); k == nil {
+				count = 0
+				break
+			}
+			if err := c.Delete(); err != nil {
+				return fmt.Errorf("Unable to trim delivery log: %v", err)
+			}
+		}
+
+		if err := lb.SetSequence(count); err != nil {
+			return fmt.Errorf("Unable to update delivery log count: %v", err)
+		}
+
+		return nil
+	})
+}
+
+//Deliveries returns up to limit queued deliveries followed by the newest logged deliveries
+//or an error if one occurred
+func (d *DB) Deliveries(limit int) ([]*db.Delivery, error) {
+	deliveries := make([]*db.Delivery, 0)
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{queueBucket, deliveriesBucket} {
+			b := tx.Bucket(name)
+			if b == nil {
+				return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, name)
+			}
+
+			c := b.Cursor()
+			for k, v := c.Last(); k != nil && len(deliveries) < limit; k, v = c.Prev() {
+				delivery := new(db.Delivery)
+				if err := json.Unmarshal(v, delivery); err != nil {
+					return fmt.Errorf("Unable to decode delivery %d: %v", binary.BigEndian.Uint64(k), err)
+				}
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+//scanEvent is the notified state and queued deliveries for a URL found by ScanEvents
+type scanEvent struct {
+	id             string
+	expiryNotified bool
+	viewsNotified  uint64
+	deliveries     []*db.Delivery
+}
+
+//ScanEvents calls fn for URLs that have expired or crossed one of the given view thresholds since the last scan.
+//URLs are scanned in a read-only transaction. The deliveries returned by fn are then queued and the URL is marked
+//so it isn't reported again, only writing the URLs that changed
+func (d *DB) ScanEvents(now time.Time, thresholds []uint64, fn func(event string, url *db.URL, threshold uint64) ([]*db.Delivery, error)) error {
+	thresholds = append([]uint64(nil), thresholds...)
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
+
+	var events []*scanEvent
+	err := d.db.View(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(urlsBucket)
+		if ub == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+		}
+
+		return ub.ForEach(func(k, v []byte) error {
+			//corrupt records are reported by CheckRecords
+			rec, err := getURL(ub, string(k))
+			if err != nil || rec == nil || rec.Deleted {
+				return nil
+			}
+
+			e := &scanEvent{id: rec.ID, expiryNotified: rec.ExpiryNotified, viewsNotified: rec.ViewsNotified}
+
+			if rec.Expires != nil && !rec.ExpiryNotified && now.After(*(rec.Expires)) {
+				ds, err := fn(db.EventExpired, &rec.URL, 0)
+				if err != nil {
+					return err
+				}
+				e.deliveries = append(e.deliveries, ds...)
+				e.expiryNotified = true
+			}
+
+			for _, t := range thresholds {
+				if t > e.viewsNotified && t <= rec.Views {
+					ds, err := fn(db.EventViews, &rec.URL, t)
+					if err != nil {
+						return err
+					}
+					e.deliveries = append(e.deliveries, ds...)
+					e.viewsNotified = t
+				}
+			}
+
+			if e.expiryNotified != rec.ExpiryNotified || e.viewsNotified != rec.ViewsNotified {
+				events = append(events, e)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(urlsBucket)
+		if ub == nil {
+			return fmt.Errorf(`Unable to open database "%s" bucket: bucket is nil`, urlsBucket)
+		}
+
+		for _, e := range events {
+			//the URL may have changed since it was scanned
+			rec, err := getURL(ub, e.id)
+			if err != nil || rec == nil || rec.Deleted {
+				continue
+			}
+			if rec.ExpiryNotified == e.expiryNotified && rec.ViewsNotified >= e.viewsNotified {
+				continue
+			}
+			//the next scan reports the URL if its expiration was changed
+			if e.expiryNotified && !rec.ExpiryNotified && (rec.Expires == nil || !now.After(*(rec.Expires))) {
+				continue
+			}
+
+			rec.ExpiryNotified = rec.ExpiryNotified || e.expiryNotified
+			if e.viewsNotified > rec.ViewsNotified {
+				rec.ViewsNotified = e.viewsNotified
+			}
+
+			if err = enqueue(tx, e.deliveries); err != nil {
+				return err
+			}
+			if err = putURL(ub, rec); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,191 @@
+package bbolt
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+//dueIDs returns the IDs of the deliveries due at now
+func dueIDs(t *testing.T, d *DB, now time.Time, limit int) []uint64 {
+	t.Helper()
+	deliveries, err := d.Due(now, limit)
+	if err != nil {
+		t.Fatalf("Unable to get due deliveries: %v", err)
+	}
+	ids := make([]uint64, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer d.Close()
+
+	for _, id := range []string{"a", "b"} {
+		if err = d.PutWebhook(&db.Webhook{ID: id, URL: "https://example.com/" + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	deliveries := []*db.Delivery{
+		{WebhookID: "a", NextAttempt: now.Add(time.Hour)},
+		{WebhookID: "a", NextAttempt: now.Add(-2 * time.Minute)},
+		{WebhookID: "b", NextAttempt: now.Add(-time.Minute)},
+		{WebhookID: "a", NextAttempt: now.Add(-3 * time.Minute)},
+	}
+	if err = d.Enqueue(deliveries...); err != nil {
+		t.Fatalf("Unable to enqueue: %v", err)
+	}
+
+	check := func(name string, now time.Time, limit int, want ...uint64) {
+		t.Helper()
+		if ids := dueIDs(t, d, now, limit); !equalIDs(ids, want) {
+			t.Errorf("%s: expected due deliveries %v, got %v", name, want, ids)
+		}
+	}
+
+	check("oldest first", now, 10, 4, 2, 3)
+	check("limit", now, 2, 4, 2)
+	check("all", now.Add(2*time.Hour), 10, 4, 2, 3, 1)
+
+	deliveries[3].NextAttempt = now.Add(90 * time.Minute)
+	deliveries[3].Attempts = 1
+	if err = d.Requeue(deliveries[3]); err != nil {
+		t.Fatalf("Unable to requeue: %v", err)
+	}
+	check("requeued later", now, 10, 2, 3)
+	check("requeued after others", now.Add(2*time.Hour), 10, 2, 3, 1, 4)
+
+	if err = d.Finish(deliveries[1]); err != nil {
+		t.Fatalf("Unable to finish: %v", err)
+	}
+	check("finished", now, 10, 3)
+
+	if err = d.DeleteWebhook("b"); err != nil {
+		t.Fatalf("Unable to delete webhook: %v", err)
+	}
+	check("webhook deleted", now.Add(2*time.Hour), 10, 1, 4)
+
+	//requeuing a delivery for a deleted webhook doesn't add it back
+	if err = d.Requeue(deliveries[2]); err != nil {
+		t.Fatalf("Unable to requeue: %v", err)
+	}
+	check("deleted not requeued", now.Add(2*time.Hour), 10, 1, 4)
+
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(scheduleBucket).Stats().KeyN; n != 2 {
+			t.Errorf("Expected 2 scheduled deliveries, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliveryLogTrim(t *testing.T) {
+	d, err := New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer d.Close()
+
+	for id := uint64(1); id <= maxDeliveryLog+5; id++ {
+		if err = d.Finish(&db.Delivery{ID: id, WebhookID: "a", Status: db.DeliveryDelivered}); err != nil {
+			t.Fatalf("Unable to finish delivery %d: %v", id, err)
+		}
+	}
+	//finishing a logged delivery again doesn't count it twice
+	if err = d.Finish(&db.Delivery{ID: maxDeliveryLog + 5, WebhookID: "a", Status: db.DeliveryDelivered}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.db.View(func(tx *bolt.Tx) error {
+		lb := tx.Bucket(deliveriesBucket)
+		if n := lb.Stats().KeyN; n != maxDeliveryLog || lb.Sequence() != maxDeliveryLog {
+			t.Errorf("Expected %d logged deliveries, got %d with count %d", maxDeliveryLog, n, lb.Sequence())
+		}
+		if k, _ := lb.Cursor().First(); string(k) != string(deliveryKey(6)) {
+			t.Errorf("Expected oldest logged delivery to be 6, got %v", k)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateDeliveries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.db")
+	d, err := New(path, 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+
+	now := time.Now()
+	if err = d.Enqueue(&db.Delivery{WebhookID: "a", NextAttempt: now.Add(-time.Minute)}, &db.Delivery{WebhookID: "a", NextAttempt: now.Add(-2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	for id := uint64(100); id < 103; id++ {
+		if err = d.Finish(&db.Delivery{ID: id, WebhookID: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//return the database to the previous schema version, without the schedule or log count
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(scheduleBucket); err != nil {
+			return err
+		}
+		if err := tx.Bucket(deliveriesBucket).SetSequence(0); err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(SchemaVersion-1)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	if d, err = New(path, 6); err != nil {
+		t.Fatalf("Unable to migrate database: %v", err)
+	}
+	defer d.Close()
+
+	if ids := dueIDs(t, d, now, 10); !equalIDs(ids, []uint64{2, 1}) {
+		t.Errorf("Expected migrated deliveries to be due, got %v", ids)
+	}
+
+	err = d.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket(deliveriesBucket).Sequence(); n != 3 {
+			t.Errorf("Expected migrated delivery log count 3, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//Stats are cache statistics
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+	Size      int    `json:"size"`
+}
+
+//entry is a resolved destination. An empty url is a cached miss
+type entry struct {
+	id      string //the cache key; see key
+	url     string
+	expires *time.Time
+	added   time.Time
+}
+
+//DB is a db.DB that caches resolved destinations for View in a bounded LRU cache.
+//Entries expire after a TTL and are invalidated when the URL is changed through DB
+type DB struct {
+	db.DB
+
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	//gen is incremented on every invalidation so a View racing with a change doesn't cache a stale entry
+	gen   uint64
+	stats Stats
+
+	//caseInsensitive is set by CaseInsensitiveIDs
+	caseInsensitive bool
+}
+
+//New returns a new *DB wrapping d that caches up to size entries for ttl
+func New(d db.DB, size int, ttl time.Duration) *DB {
+	return &DB{DB: d, size: size, ttl: ttl, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+//CaseInsensitiveIDs keys entries by lowercased ID, so IDs that differ only in case, which resolve to the same URL,
+//share an entry. It should be called before the DB is used
+func (c *DB) CaseInsensitiveIDs() {
+	c.caseInsensitive = true
+}
+
+//key returns the cache key for id
+func (c *DB) key(id string) string {
+	if c.caseInsensitive {
+		return strings.ToLower(id)
+	}
+	return id
+}
+
+//get returns the cached entry for id or nil if it isn't cached or is too old, and the current generation
+func (c *DB) get(id string) (*entry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id = c.key(id)
+	el, ok := c.items[id]
+	if !ok {
+		c.stats.Misses++
+		return nil, c.gen
+	}
+
+	e := el.Value.(*entry)
+	if time.Since(e.added) > c.ttl {
+		c.ll.Remove(el)
+		delete(c.items, id)
+		c.stats.Misses++
+		return nil, c.gen
+	}
+
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return e, c.gen
+}
+
+//add caches e if nothing has been invalidated since generation gen
+func (c *DB) add(e *entry, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	if el, ok := c.items[e.id]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[e.id] = c.ll.PushFront(e)
+
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*entry).id)
+		c.stats.Evictions++
+	}
+}
+
+//Invalidate removes the cached entry for id
+func (c *DB) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	id = c.key(id)
+	if el, ok := c.items[id]; ok {
+		c.ll.Remove(el)
+		delete(c.items, id)
+	}
+}
+
+//related returns the ID and aliases of the URL id resolves to, so a change made through an alias
+//invalidates every key for the URL. It returns nil if the URL doesn't exist or can't be read
+func (c *DB) related(id string) []string {
+	u, err := c.DB.Get(id)
+	if err != nil || u == nil {
+		return nil
+	}
+	return append([]string{u.ID}, u.Aliases...)
+}
+
+//invalidateAll removes the cached entries for each of ids
+func (c *DB) invalidateAll(ids []string) {
+	for _, id := range ids {
+		c.Invalidate(id)
+	}
+}
+
+//Stats returns the current cache statistics
+func (c *DB) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	stats.Size = c.size
+	return stats
+}
+
+//Resolve returns the url with the given id from the cache or database, or an error if one occurred.
+//If a url with the given id doesn't exist, url will be empty, and if it's expired, err will be db.ErrExpired. Resolve doesn't count a view
+func (c *DB) Resolve(id string) (url string, err error) {
+	e, gen := c.get(id)
+	if e == nil {
+		u, err := c.DB.Get(id)
+		if err != nil {
+			return "", fmt.Errorf(`Unable to get url "%s": %v`, id, err)
+		}
+
+		e = &entry{id: c.key(id), added: time.Now()}
+		if u != nil {
+			e.url = u.URL
+			e.expires = u.Expires
+		}
+		c.add(e, gen)
+	}
+
+	//check exists
+	if e.url == "" {
+		return "", nil
+	}
+
+	//check expired
+	if e.expires != nil && time.Now().After(*(e.expires)) {
+		return "", db.ErrExpired
+	}
+
+	return e.url, nil
+}
+
+//View returns the url with the given id, or an error if one occurred.
+//If a url with the given id doesn't exist, url will be empty. If it's expired, err will be db.ErrExpired.
+//View resolves the url from the cache if possible and increments the view counter for the URL
+func (c *DB) View(id string) (url string, err error) {
+	if url, err = c.Resolve(id); err != nil || url == "" {
+		return url, err
+	}
+
+	if err = c.DB.CountView(id); err != nil {
+		return "", fmt.Errorf(`Unable to count view for url "%s": %v`, id, err)
+	}
+
+	return url, nil
+}
+
+//Put saves the given url in the database for the given user, returning the id, or an error
+//if one occurred.
+func (c *DB) Put(url *db.URL, user string) (id string, err error) {
+	id, err = c.DB.Put(url, user)
+	c.Invalidate(id)
+	return id, err
+}
+
+//Import saves the given url in the database as-is or returns an error if one occurred
+func (c *DB) Import(url *db.URL) error {
+	err := c.DB.Import(url)
+	c.Invalidate(url.ID)
+	return err
+}
+
+//Update updates the *URL with the given id as the given user or returns an error if one occurred
+func (c *DB) Update(id string, url *db.URL, user string) error {
+	related := c.related(id)
+	err := c.DB.Update(id, url, user)
+	c.Invalidate(id)
+	c.invalidateAll(related)
+	return err
+}
+
+//Delete deletes the *URL with the given id as the given user or returns an error if one occurred
+func (c *DB) Delete(id, user string) error {
+	related := c.related(id)
+	err := c.DB.Delete(id, user)
+	c.Invalidate(id)
+	c.invalidateAll(related)
+	return err
+}
+
+//Restore restores the deleted *URL with the given id as the given user or returns an error if one occurred
+func (c *DB) Restore(id, user string) error {
+	err := c.DB.Restore(id, user)
+	c.Invalidate(id)
+	c.invalidateAll(c.related(id))
+	return err
+}
+
+//AddAlias adds alias as another ID for the *URL with the given id or returns an error if one occurred
+func (c *DB) AddAlias(id, alias string) error {
+	err := c.DB.AddAlias(id, alias)
+	c.Invalidate(alias)
+	return err
+}
+
+//RemoveAlias removes alias from the *URL with the given id or returns an error if one occurred
+func (c *DB) RemoveAlias(id, alias string) error {
+	err := c.DB.RemoveAlias(id, alias)
+	c.Invalidate(alias)
+	return err
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+)
+
+func TestCaseInsensitiveInvalidate(t *testing.T) {
+	b, err := bbolt.New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer b.Close()
+	b.CaseInsensitiveIDs()
+
+	c := New(b, 100, time.Hour)
+	c.CaseInsensitiveIDs()
+
+	tests := []struct {
+		name   string
+		change func() error
+		id     string
+		want   string
+	}{
+		{"cached miss", func() error { return nil }, "Handbook", ""},
+		{"put invalidates miss", func() error {
+			_, err := c.Put(&db.URL{ID: "handbook", URL: "https://example.com/a"}, "alice")
+			return err
+		}, "HANDBOOK", "https://example.com/a"},
+		{"update invalidates other case", func() error {
+			return c.Update("handbook", &db.URL{URL: "https://example.com/b"}, "alice")
+		}, "Handbook", "https://example.com/b"},
+		{"delete invalidates other case", func() error { return c.Delete("handbook", "alice") }, "hAnDbOoK", ""},
+	}
+
+	for _, test := range tests {
+		if err := test.change(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		url, err := c.Resolve(test.id)
+		if err != nil {
+			t.Fatalf("%s: unable to resolve %s: %v", test.name, test.id, err)
+		}
+		if url != test.want {
+			t.Errorf("%s: expected %s to resolve to %q, got %q", test.name, test.id, test.want, url)
+		}
+	}
+
+	if entries := c.Stats().Entries; entries != 1 {
+		t.Errorf("Expected 1 entry for all cases of handbook, got %d", entries)
+	}
+}
+
+//stubDB is a db.DB that resolves URLs and their aliases from a map and counts reads
+type stubDB struct {
+	db.DB
+	urls map[string]*db.URL
+	gets int
+	//onGet is called during Get, before the URL is returned
+	onGet func()
+}
+
+func (d *stubDB) lookup(id string) *db.URL {
+	if u, ok := d.urls[id]; ok {
+		return u
+	}
+	for _, u := range d.urls {
+		for _, alias := range u.Aliases {
+			if alias == id {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+func (d *stubDB) Get(id string) (*db.URL, error) {
+	d.gets++
+	if d.onGet != nil {
+		d.onGet()
+	}
+	u := d.lookup(id)
+	if u == nil {
+		return nil, nil
+	}
+	url := *u
+	return &url, nil
+}
+
+func (d *stubDB) Put(url *db.URL, user string) (string, error) {
+	d.urls[url.ID] = url
+	return url.ID, nil
+}
+
+func (d *stubDB) Update(id string, url *db.URL, user string) error {
+	d.lookup(id).URL = url.URL
+	return nil
+}
+
+func (d *stubDB) Delete(id, user string) error {
+	delete(d.urls, d.lookup(id).ID)
+	return nil
+}
+
+func newStubDB() *stubDB {
+	return &stubDB{urls: map[string]*db.URL{
+		"a": {ID: "a", URL: "https://example.com/a", Aliases: []string{"alias"}},
+		"b": {ID: "b", URL: "https://example.com/b"},
+		"c": {ID: "c", URL: "https://example.com/c"},
+	}}
+}
+
+//resolve resolves id through c and fails the test if it doesn't resolve to want
+func resolve(t *testing.T, c *DB, id, want string) {
+	t.Helper()
+	url, err := c.Resolve(id)
+	if err != nil {
+		t.Fatalf("Unable to resolve %s: %v", id, err)
+	}
+	if url != want {
+		t.Errorf("Expected %s to resolve to %q, got %q", id, want, url)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	d := newStubDB()
+	c := New(d, 2, time.Hour)
+
+	resolve(t, c, "a", "https://example.com/a")
+	resolve(t, c, "b", "https://example.com/b")
+	//a is now the most recently used, so b is evicted for c
+	resolve(t, c, "a", "https://example.com/a")
+	resolve(t, c, "c", "https://example.com/c")
+
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("Expected 2 entries, 1 eviction, 1 hit, and 3 misses, got %+v", stats)
+	}
+
+	gets := d.gets
+	resolve(t, c, "a", "https://example.com/a")
+	resolve(t, c, "c", "https://example.com/c")
+	if d.gets != gets {
+		t.Errorf("Expected a and c to be cached, got %d reads", d.gets-gets)
+	}
+	resolve(t, c, "b", "https://example.com/b")
+	if d.gets != gets+1 {
+		t.Errorf("Expected evicted b to be read, got %d reads", d.gets-gets)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	d := newStubDB()
+	c := New(d, 10, time.Minute)
+
+	resolve(t, c, "a", "https://example.com/a")
+	d.urls["a"].URL = "https://example.com/changed"
+	resolve(t, c, "a", "https://example.com/a")
+
+	c.items["a"].Value.(*entry).added = time.Now().Add(-2 * time.Minute)
+	resolve(t, c, "a", "https://example.com/changed")
+	if d.gets != 2 {
+		t.Errorf("Expected expired entry to be read again, got %d reads", d.gets)
+	}
+}
+
+func TestNegative(t *testing.T) {
+	d := newStubDB()
+	c := New(d, 10, time.Hour)
+
+	resolve(t, c, "missing", "")
+	resolve(t, c, "missing", "")
+	if d.gets != 1 {
+		t.Errorf("Expected missing URL to be cached, got %d reads", d.gets)
+	}
+
+	//a miss is invalidated when the ID is created
+	if _, err := c.Put(&db.URL{ID: "missing", URL: "https://example.com/missing"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	resolve(t, c, "missing", "https://example.com/missing")
+}
+
+func TestGeneration(t *testing.T) {
+	d := newStubDB()
+	c := New(d, 10, time.Hour)
+
+	//a change made while a URL is read from the database may have made the read stale, so it isn't cached
+	d.onGet = func() { c.Invalidate("b") }
+	resolve(t, c, "a", "https://example.com/a")
+	if entries := c.Stats().Entries; entries != 0 {
+		t.Errorf("Expected stale read not to be cached, got %d entries", entries)
+	}
+
+	d.onGet = nil
+	resolve(t, c, "a", "https://example.com/a")
+	if entries := c.Stats().Entries; entries != 1 {
+		t.Errorf("Expected read to be cached, got %d entries", entries)
+	}
+}
+
+func TestAliasInvalidate(t *testing.T) {
+	d := newStubDB()
+	c := New(d, 10, time.Hour)
+
+	resolve(t, c, "a", "https://example.com/a")
+	resolve(t, c, "alias", "https://example.com/a")
+
+	if err := c.Update("alias", &db.URL{URL: "https://example.com/updated"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	resolve(t, c, "a", "https://example.com/updated")
+	resolve(t, c, "alias", "https://example.com/updated")
+
+	if err := c.Delete("alias", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	resolve(t, c, "a", "")
+	resolve(t, c, "alias", "")
+}
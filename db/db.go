@@ -1,8 +1,16 @@
 package db
 
+import (
+	"errors"
+	"io"
+)
+
+//ErrExpired is returned by View and Resolve for expired URLs, so they can be told apart from missing ones
+var ErrExpired = errors.New("URL is expired")
+
 //DB represents a URL shortening database
 type DB interface {
-	//Get returns the *URL with the given id, or an error if one occurred.
+	//Get returns the *URL with the given id or alias, or an error if one occurred.
 	//If a *URL with the given id doesn't exist, url will be nil
 	Get(id string) (url *URL, err error)
 
@@ -10,19 +18,99 @@ type DB interface {
 	//if one occurred.
 	Put(url *URL, user string) (id string, err error)
 
-	//Update updates the *URL with the given id or returns an error if one occurred
-	Update(id string, url *URL) error
+	//Import saves the given url in the database as-is, preserving its ID, User, Views, Created, and LastModified,
+	//or returns an error if one occurred. If a *URL with the same id already exists, an error is returned.
+	Import(url *URL) error
+
+	//Update updates the *URL with the given id as the given user or returns an error if one occurred.
+	//Created and CreatedBy are preserved
+	Update(id string, url *URL, user string) error
+
+	//Delete deletes the *URL with the given id as the given user or returns an error if one occurred
+	Delete(id, user string) error
+
+	//Restore restores the deleted *URL with the given id as the given user or returns an error if one occurred
+	Restore(id, user string) error
+
+	//AddAlias adds alias as another ID for the *URL with the given id or returns an error if one occurred.
+	//If alias is already used by a URL or alias, an error is returned
+	AddAlias(id, alias string) error
+
+	//RemoveAlias removes alias from the *URL with the given id or returns an error if one occurred
+	RemoveAlias(id, alias string) error
 
-	//Delete deletes the *URL with the given id or returns an error if one occurred
-	Delete(id string) error
+	//Available returns true if id isn't used by a URL or alias, or an error if one occurred.
+	//IDs of deleted URLs are available
+	Available(id string) (bool, error)
+
+	//Transfer changes the owner of the *URL with the given id to owner as the given user or returns an error if one occurred
+	Transfer(id, owner, user string) error
 
 	//View returns the url with the given id, or an error if one occurred.
-	//If a url with the given id doesn't exist, url will be empty.
+	//If a url with the given id doesn't exist, url will be empty. If it's expired, err will be ErrExpired.
 	//View increments the view counter for the URL and should be used
 	//by clients wanting to resolve the shortened URL.
 	View(id string) (url string, err error)
 
+	//Resolve returns the url with the given id like View, but doesn't count a view
+	Resolve(id string) (url string, err error)
+
+	//CountView increments the view counter for the URL with the given id or returns an error if one occurred.
+	//It's used by clients that resolve the URL some other way, e.g. from a cache
+	CountView(id string) error
+
+	//CountBotView increments the bot view counter for the URL with the given id or returns an error if one occurred.
+	//Bot views are requests from crawlers and link unfurlers, and are counted separately from views
+	CountBotView(id string) error
+
 	//URLs returns the URLs for the given user or all URLs if user is empty
 	//or an error if one occurred
 	URLs(user string) ([]*URL, error)
+
+	//TaggedURLs returns the URLs with the given tag for the given user, or all users if user is empty,
+	//or an error if one occurred
+	TaggedURLs(user, tag string) ([]*URL, error)
+
+	//Tags returns a map of tag to number of URLs for the given user, or all users if user is empty,
+	//or an error if one occurred
+	Tags(user string) (map[string]int, error)
+
+	//DestinationURLs returns the URLs for the given user, or all users if user is empty, whose destination
+	//is the same as destination after normalizing both with NormalizeDestination, or an error if one occurred
+	DestinationURLs(user, destination string) ([]*URL, error)
+
+	//Duplicates returns the destinations shared by more than one URL, with the most shared first,
+	//or an error if one occurred
+	Duplicates() ([]*Duplicate, error)
+
+	//Search returns up to limit URLs matching query for the given user, or all users if user is empty,
+	//ranked from best to worst match, or an error if one occurred
+	Search(user, query string, limit int) ([]*SearchResult, error)
+
+	//Users returns the users that own URLs or an error if one occurred
+	Users() ([]string, error)
+
+	//Signatures returns a map of user to API signature token or an error if one occurred
+	Signatures() (map[string]string, error)
+
+	//SetSignature sets the API signature token for the given user or returns an error if one occurred
+	SetSignature(user, signature string) error
+
+	//SetUnfurl sets the fetched Unfurl metadata for the URL with the given id without changing LastModified,
+	//or returns an error if one occurred. Missing and deleted URLs are ignored
+	SetUnfurl(id string, unfurl *Unfurl) error
+
+	//DisplayName returns the display name for the given user, or an empty string if it isn't known,
+	//or an error if one occurred
+	DisplayName(user string) (string, error)
+
+	//SetDisplayName sets the display name for the given user or returns an error if one occurred
+	SetDisplayName(user, name string) error
+
+	//Backup writes a consistent snapshot of the database to w and returns the number of bytes written,
+	//or an error if one occurred. Backup is safe to call while the database is in use
+	Backup(w io.Writer) (int64, error)
+
+	//Ping returns an error if the database can't be read
+	Ping() error
 }
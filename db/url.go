@@ -1,6 +1,162 @@
 package db
 
-import "time"
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//IDRegexp is the regular expression a URL ID must match
+const IDRegexp = "[a-zA-Z0-9_\\-.]+"
+
+//ReservedIDs can't be used as URL IDs because they're routed elsewhere
+var ReservedIDs = map[string]bool{"api": true, "healthz": true, "readyz": true, "metrics": true, "error.html": true, "available": true}
+
+//QRFormats are the supported QR code image formats
+var QRFormats = []string{"png", "svg"}
+
+//ReservedID returns true if id can't be used as a URL ID. IDs ending in a QR code extension are reserved so /{id}.png stays unambiguous
+func ReservedID(id string) bool {
+	for _, format := range QRFormats {
+		if strings.HasSuffix(id, "."+format) {
+			return true
+		}
+	}
+	return ReservedIDs[id]
+}
+
+//TagRegexp is the regular expression a normalized tag must match
+const TagRegexp = "[a-z0-9_\\-.]+"
+
+//MaxTags is the maximum number of tags on a URL
+const MaxTags = 32
+
+//MaxTagLength is the maximum length of a tag
+const MaxTagLength = 64
+
+//MaxTitleLength and MaxDescriptionLength are the maximum lengths of a URL's title and description
+const (
+	MaxTitleLength       = 256
+	MaxDescriptionLength = 4096
+)
+
+var tagRegexp = regexp.MustCompile("^" + TagRegexp + "$")
+
+var idRegexp = regexp.MustCompile("^" + IDRegexp + "$")
+
+//ValidateID returns an error if id doesn't match IDRegexp or is reserved
+func ValidateID(id string) error {
+	if !idRegexp.MatchString(id) {
+		return fmt.Errorf("URL ID %s not valid", id)
+	}
+	if ReservedID(id) {
+		return fmt.Errorf("URL ID %s is reserved", id)
+	}
+	return nil
+}
+
+//ValidateURL checks the destination and ID, if set, of a new url and normalizes it with NormalizeURL,
+//or returns an error if it's invalid. If the ID is reserved, the error contains "is reserved"
+func ValidateURL(url *URL) error {
+	if _, err := neturl.ParseRequestURI(url.URL); err != nil {
+		return fmt.Errorf(`Unable to parse url "%s": %v`, url.URL, err)
+	}
+
+	if url.ID != "" {
+		if err := ValidateID(url.ID); err != nil {
+			return err
+		}
+	}
+
+	return NormalizeURL(url)
+}
+
+//NormalizeURL trims the title and description and normalizes the tags of url, or returns an error if they're invalid
+func NormalizeURL(url *URL) error {
+	url.Title = strings.TrimSpace(url.Title)
+	if len(url.Title) > MaxTitleLength {
+		return fmt.Errorf("Title is longer than %d characters", MaxTitleLength)
+	}
+
+	url.Description = strings.TrimSpace(url.Description)
+	if len(url.Description) > MaxDescriptionLength {
+		return fmt.Errorf("Description is longer than %d characters", MaxDescriptionLength)
+	}
+
+	tags, err := NormalizeTags(url.Tags)
+	if err != nil {
+		return err
+	}
+	url.Tags = tags
+
+	return nil
+}
+
+//NormalizeTags returns tags lowercased, trimmed, deduplicated, and sorted, or an error if a tag is invalid
+//or there are more than MaxTags
+func NormalizeTags(tags []string) ([]string, error) {
+	set := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if len(t) > MaxTagLength || !tagRegexp.MatchString(t) {
+			return nil, fmt.Errorf(`Tag "%s" not valid`, t)
+		}
+		set[t] = true
+	}
+
+	if len(set) > MaxTags {
+		return nil, fmt.Errorf("URL has %d tags; the maximum is %d", len(set), MaxTags)
+	}
+
+	normalized := make([]string, 0, len(set))
+	for t := range set {
+		normalized = append(normalized, t)
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+//NormalizeDestination returns destination with a lowercase scheme and host, without a default port, fragment,
+//or empty query, with an empty path replaced by "/", and with query parameters sorted, so equivalent destinations
+//compare equal. Destinations that can't be parsed are returned trimmed
+func NormalizeDestination(destination string) string {
+	destination = strings.TrimSpace(destination)
+	u, err := neturl.Parse(destination)
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		return destination
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+	}
+
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.RawQuery != "" {
+		if q, err := neturl.ParseQuery(u.RawQuery); err == nil {
+			u.RawQuery = q.Encode()
+		}
+	}
+	u.ForceQuery = false
+
+	return u.String()
+}
 
 //URL represents a shortened URL
 type URL struct {
@@ -8,6 +164,49 @@ type URL struct {
 	User         string     `json:"user"`
 	URL          string     `json:"url"`
 	Views        uint64     `json:"views"`
+	BotViews     uint64     `json:"bot_views"`
 	Expires      *time.Time `json:"expires"`
+	Created      *time.Time `json:"created"`
+	CreatedBy    string     `json:"created_by"`
 	LastModified *time.Time `json:"last_modified"`
+	ModifiedBy   string     `json:"modified_by"`
+
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+
+	//Aliases are other IDs that resolve to this URL. Views through an alias are included in Views and counted
+	//per alias in AliasViews. They're set by the server and ignored in updates
+	Aliases    []string          `json:"aliases"`
+	AliasViews map[string]uint64 `json:"alias_views,omitempty"`
+
+	//UnfurlTitle and UnfurlDescription override the fetched Unfurl title and description
+	UnfurlTitle       string `json:"unfurl_title,omitempty"`
+	UnfurlDescription string `json:"unfurl_description,omitempty"`
+
+	//Unfurl is the metadata fetched from the destination page. It's set by the server and ignored in updates
+	Unfurl *Unfurl `json:"unfurl,omitempty"`
+}
+
+//SearchResult is a URL matching a search query. Higher scores are better matches
+type SearchResult struct {
+	*URL
+	Score float64 `json:"score"`
+}
+
+//Duplicate is a destination shared by more than one URL
+type Duplicate struct {
+	Destination string `json:"destination"`
+	URLs        []*URL `json:"urls"`
+}
+
+//Unfurl is metadata fetched from a URL's destination page, used to unfurl short URLs in chat apps
+type Unfurl struct {
+	//URL is the destination the metadata was fetched from. Metadata for a different destination is stale
+	URL         string     `json:"url"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Image       string     `json:"image,omitempty"`
+	Fetched     *time.Time `json:"fetched"`
+	Error       string     `json:"error,omitempty"`
 }
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//Webhook events
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	EventExpired = "expired"
+	EventViews   = "views"
+)
+
+//Events are all webhook events
+var Events = []string{EventCreated, EventUpdated, EventDeleted, EventExpired, EventViews}
+
+//Webhook is an endpoint that receives signed event payloads
+type Webhook struct {
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	Secret    string     `json:"secret,omitempty"`
+	Events    []string   `json:"events"`
+	Created   *time.Time `json:"created"`
+	CreatedBy string     `json:"created_by"`
+}
+
+//Subscribed returns true if the webhook receives the given event. A webhook with no events receives all events
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+//Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+//Delivery is an event payload queued for or sent to a webhook
+type Delivery struct {
+	ID          uint64          `json:"id"`
+	WebhookID   string          `json:"webhook_id"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	Created     time.Time       `json:"created"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	Finished    *time.Time      `json:"finished,omitempty"`
+}
+
+//WebhookStore stores webhooks and their delivery queue and log
+type WebhookStore interface {
+	//Webhooks returns all webhooks or an error if one occurred
+	Webhooks() ([]*Webhook, error)
+
+	//PutWebhook saves the given webhook, generating its ID if empty, or returns an error if one occurred
+	PutWebhook(hook *Webhook) error
+
+	//DeleteWebhook deletes the webhook with the given id and its pending deliveries
+	//or returns an error if one occurred
+	DeleteWebhook(id string) error
+
+	//Enqueue adds the given deliveries to the queue, setting their IDs, or returns an error if one occurred
+	Enqueue(deliveries ...*Delivery) error
+
+	//Due returns up to limit queued deliveries whose next attempt is at or before now
+	//or an error if one occurred
+	Due(now time.Time, limit int) ([]*Delivery, error)
+
+	//Requeue saves a queued delivery after a failed attempt or returns an error if one occurred
+	Requeue(delivery *Delivery) error
+
+	//Finish removes a delivery from the queue and adds it to the delivery log, keeping only the newest
+	//entries, or returns an error if one occurred
+	Finish(delivery *Delivery) error
+
+	//Deliveries returns up to limit queued deliveries followed by the newest logged deliveries
+	//or an error if one occurred
+	Deliveries(limit int) ([]*Delivery, error)
+
+	//ScanEvents calls fn for URLs that have expired or crossed one of the given view thresholds since the last scan.
+	//The deliveries returned by fn are queued and the URL is marked so it isn't reported again, atomically.
+	//fn must not access the store
+	ScanEvents(now time.Time, thresholds []uint64, fn func(event string, url *URL, threshold uint64) ([]*Delivery, error)) error
+}
@@ -0,0 +1,175 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/httputil/session"
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/db/cache"
+	"github.com/korylprince/url-shortener-server/v2/importer"
+)
+
+const maxImportSize = 64 << 20
+
+//writeError writes a JSON error response in the same format as jsonapi
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, code int) {
+	type response struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(&response{Code: code, Description: http.StatusText(code)}); err != nil {
+		s.requestLogger(r).Error("Unable to write JSON response", "error", err)
+	}
+}
+
+//checkSession returns the session for the request's Authorization header.
+//It is used for handlers that don't go through jsonapi
+func (s *Server) checkSession(r *http.Request) (session.Session, int, error) {
+	header := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(header) != 2 || header[0] != "Bearer" {
+		return nil, http.StatusBadRequest, errors.New("Invalid Authorization header")
+	}
+
+	sess, err := s.sessionStore.Read(header[1])
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Unexpected error when checking session id %s: %v", header[1], err)
+	}
+
+	if sess == nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("Session doesn't exist for id %s", header[1])
+	}
+
+	logUser(r, sess.Username())
+
+	return sess, http.StatusOK, nil
+}
+
+//checkAdmin checks the request has a valid session for an admin user
+func (s *Server) checkAdmin(r *http.Request) (int, error) {
+	sess, code, err := s.checkSession(r)
+	if err != nil {
+		return code, err
+	}
+
+	if !s.isAdmin(sess) {
+		return http.StatusForbidden, fmt.Errorf("User %s is not an admin", sess.Username())
+	}
+
+	return http.StatusOK, nil
+}
+
+//withAdmin returns an http.Handler that only calls next for requests with a valid admin session.
+//It is used for handlers that don't return JSON
+func (s *Server) withAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code, err := s.checkAdmin(r); err != nil {
+			s.requestLogger(r).Warn("Admin request denied", "path", r.URL.Path, "status", code, "error", err)
+			s.writeError(w, r, code)
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="urls-%s.db"`, time.Now().UTC().Format("20060102T150405Z")))
+
+	//large databases take longer than the server's WriteTimeout to send
+	if err := clearWriteDeadline(w); err != nil {
+		s.requestLogger(r).Warn("Unable to clear write deadline for backup", "error", err)
+	}
+
+	n, err := s.db.Backup(w)
+	if err != nil {
+		//headers have already been sent, so the client will see a truncated response
+		s.requestLogger(r).Error("Unable to write backup", "bytes", n, "error", err)
+	}
+}
+
+func (s *Server) importHandler(r *http.Request) (int, interface{}) {
+	session := jsonapi.GetSession(r)
+	user := session.Username()
+	if !s.isAdmin(session) {
+		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to import URLs", user)
+	}
+
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("Unable to parse form: %v", err)
+	}
+
+	format := r.FormValue("format")
+	logActionID(r, format)
+
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("Unable to read file: %v", err)
+	}
+	defer f.Close()
+
+	records, err := importer.Parse(format, f)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("Unable to parse %s import: %v", format, err)
+	}
+
+	opts := &importer.Options{Owners: map[string]string{}, DryRun: r.FormValue("dry_run") == "true", CaseInsensitiveIDs: s.CaseInsensitiveIDs}
+
+	if of, _, err := r.FormFile("owners"); err == nil {
+		defer of.Close()
+		if opts.Owners, err = importer.ReadOwners(of); err != nil {
+			return http.StatusBadRequest, err
+		}
+	} else if err != http.ErrMissingFile {
+		return http.StatusBadRequest, fmt.Errorf("Unable to read owners file: %v", err)
+	}
+
+	report, err := importer.Import(s.db, records, opts)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to import URLs: %v", err)
+	}
+
+	return http.StatusOK, report
+}
+
+func (s *Server) duplicatesHandler(r *http.Request) (int, interface{}) {
+	type response struct {
+		Duplicates []*db.Duplicate `json:"duplicates"`
+	}
+
+	session := jsonapi.GetSession(r)
+	user := session.Username()
+	if !s.isAdmin(session) {
+		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to view duplicate destinations", user)
+	}
+
+	duplicates, err := s.db.Duplicates()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get duplicate destinations: %v", err)
+	}
+
+	return http.StatusOK, &response{Duplicates: duplicates}
+}
+
+func (s *Server) cacheHandler(r *http.Request) (int, interface{}) {
+	session := jsonapi.GetSession(r)
+	user := session.Username()
+	if !s.isAdmin(session) {
+		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to view cache statistics", user)
+	}
+
+	c, ok := s.db.(*cache.DB)
+	if !ok {
+		return http.StatusNotFound, errors.New("Cache is disabled")
+	}
+
+	return http.StatusOK, c.Stats()
+}
@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/korylprince/httputil/session/memory"
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+)
+
+//slowWriter delays the first write, like a client downloading a large backup
+type slowWriter struct {
+	http.ResponseWriter
+	delay time.Duration
+	slept bool
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	if !w.slept {
+		time.Sleep(w.delay)
+		w.slept = true
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *slowWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestBackupWriteTimeout(t *testing.T) {
+	dir := t.TempDir()
+	d, err := bbolt.New(filepath.Join(dir, "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	defer d.Close()
+	if _, err = d.Put(&db.URL{ID: "backup", URL: "https://example.com/backup"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer("", d, nil, "", memory.New(time.Minute), nil, io.Discard)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.backupHandler(&loggingWriter{ResponseWriter: &slowWriter{ResponseWriter: w, delay: 200 * time.Millisecond}}, r)
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Unable to get backup: %v", err)
+	}
+	defer resp.Body.Close()
+
+	path := filepath.Join(dir, "backup.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		t.Fatalf("Unable to read backup: %v", err)
+	}
+	f.Close()
+
+	backup, err := bbolt.New(path, 6)
+	if err != nil {
+		t.Fatalf("Unable to open backup: %v", err)
+	}
+	defer backup.Close()
+
+	url, err := backup.Get("backup")
+	if err != nil || url == nil || url.URL != "https://example.com/backup" {
+		t.Errorf("Expected backup to contain URL, got %v, %v", url, err)
+	}
+}
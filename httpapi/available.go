@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/idgen"
+)
+
+//ID availability statuses
+const (
+	idAvailable = "available"
+	idTaken     = "taken"
+	idReserved  = "reserved"
+	idInvalid   = "invalid"
+)
+
+//maxSuggestions is the number of alternative IDs suggested when an ID isn't available
+const maxSuggestions = 5
+
+//invalidIDCharsRegexp matches runs of characters not allowed in IDs
+var invalidIDCharsRegexp = regexp.MustCompile(`[^a-zA-Z0-9_\-.]+`)
+
+//idStatus returns the availability status of id and the reason it isn't available, or an error if one occurred
+func (s *Server) idStatus(id string) (status, reason string, err error) {
+	if !validIDRegexp.MatchString(id) {
+		return idInvalid, fmt.Sprintf("ID must match %s", allowedIDRegexp), nil
+	}
+
+	if db.ReservedID(id) {
+		if db.ReservedIDs[id] {
+			return idReserved, "ID is used by the server", nil
+		}
+		return idReserved, fmt.Sprintf("ID can't end in a QR code extension (%s)", strings.Join(qrFormats, ", ")), nil
+	}
+
+	available, err := s.db.Available(id)
+	if err != nil {
+		return "", "", err
+	}
+	if !available {
+		return idTaken, "ID is used by another URL or alias", nil
+	}
+
+	return idAvailable, "", nil
+}
+
+//suggestIDs returns up to maxSuggestions available IDs similar to id, or an error if one occurred
+func (s *Server) suggestIDs(id string) ([]string, error) {
+	suggestions := make([]string, 0, maxSuggestions)
+
+	//suggest alternatives to invalid IDs with the invalid characters replaced
+	base := strings.Trim(invalidIDCharsRegexp.ReplaceAllString(id, "-"), "-")
+	if base == "" {
+		return suggestions, nil
+	}
+
+	candidates := idgen.Variations(base)
+	if base != id {
+		candidates = append([]string{base}, candidates...)
+	}
+
+	for _, c := range candidates {
+		if len(suggestions) >= maxSuggestions {
+			break
+		}
+
+		status, _, err := s.idStatus(c)
+		if err != nil {
+			return nil, err
+		}
+		if status == idAvailable {
+			suggestions = append(suggestions, c)
+		}
+	}
+
+	return suggestions, nil
+}
+
+func (s *Server) availableHandler(r *http.Request) (int, interface{}) {
+	type response struct {
+		ID          string   `json:"id"`
+		Status      string   `json:"status"`
+		Reason      string   `json:"reason,omitempty"`
+		Suggestions []string `json:"suggestions"`
+	}
+
+	id := s.normalizeID(mux.Vars(r)["id"])
+
+	status, reason, err := s.idStatus(id)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to check URL ID %s: %v", id, err)
+	}
+
+	suggestions := make([]string, 0)
+	if status != idAvailable {
+		if suggestions, err = s.suggestIDs(id); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Unable to suggest URL IDs for %s: %v", id, err)
+		}
+	}
+
+	return http.StatusOK, &response{ID: id, Status: status, Reason: reason, Suggestions: suggestions}
+}
@@ -0,0 +1,14 @@
+//go:build go1.20
+// +build go1.20
+
+package httpapi
+
+import (
+	"net/http"
+	"time"
+)
+
+//clearWriteDeadline removes the server's WriteTimeout for the response written to w
+func clearWriteDeadline(w http.ResponseWriter) error {
+	return http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,15 @@
+//go:build !go1.20
+// +build !go1.20
+
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+)
+
+//clearWriteDeadline removes the server's WriteTimeout for the response written to w.
+//Write deadlines can only be changed when built with Go 1.20 or later
+func clearWriteDeadline(w http.ResponseWriter) error {
+	return errors.New("changing write deadlines requires Go 1.20 or later")
+}
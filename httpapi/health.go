@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+//defaultReadyTimeout is used for readiness checks if Server.ReadyTimeout isn't set
+const defaultReadyTimeout = 2 * time.Second
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.requestLogger(r).Error("Unable to write JSON response", "error", err)
+	}
+}
+
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Status string `json:"status"`
+	}
+
+	s.writeJSON(w, r, http.StatusOK, &response{Status: "ok"})
+}
+
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Status        string            `json:"status"`
+		Version       string            `json:"version"`
+		Started       time.Time         `json:"started"`
+		UptimeSeconds int64             `json:"uptime_seconds"`
+		Checks        map[string]string `json:"checks"`
+	}
+
+	resp := &response{
+		Status:        "ok",
+		Version:       s.Version,
+		Started:       s.started,
+		UptimeSeconds: int64(time.Since(s.started) / time.Second),
+		Checks:        map[string]string{"database": "ok"},
+	}
+	code := http.StatusOK
+
+	if err := s.db.Ping(); err != nil {
+		s.requestLogger(r).Warn("Readiness check failed", "check", "database", "error", err)
+		resp.Checks["database"] = err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
+	if s.LDAPCheckAddr != "" {
+		timeout := s.ReadyTimeout
+		if timeout == 0 {
+			timeout = defaultReadyTimeout
+		}
+
+		resp.Checks["ldap"] = "ok"
+		conn, err := net.DialTimeout("tcp", s.LDAPCheckAddr, timeout)
+		if err != nil {
+			s.requestLogger(r).Warn("Readiness check failed", "check", "ldap", "error", err)
+			resp.Checks["ldap"] = err.Error()
+			code = http.StatusServiceUnavailable
+		} else {
+			conn.Close()
+		}
+	}
+
+	if code != http.StatusOK {
+		resp.Status = "unavailable"
+	}
+
+	s.writeJSON(w, r, code, resp)
+}
@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/url-shortener-server/v2/logger"
+	"github.com/korylprince/url-shortener-server/v2/rand"
+)
+
+//requestIDHeader is the header used to propagate request IDs
+const requestIDHeader = "X-Request-ID"
+
+//requestIDLength is the length of generated request IDs
+const requestIDLength = 16
+
+//maxRequestIDLength is the maximum length of a propagated request ID
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const contextKeyRequestInfo contextKey = 0
+
+//requestInfo is filled in by handlers and logged when the request completes
+type requestInfo struct {
+	user     string
+	actionID string
+	err      error
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	if info, ok := r.Context().Value(contextKeyRequestInfo).(*requestInfo); ok {
+		return info
+	}
+	return new(requestInfo)
+}
+
+//logUser sets the user logged for the given request
+func logUser(r *http.Request, user string) {
+	getRequestInfo(r).user = user
+}
+
+//logActionID sets the action ID logged for the given request
+func logActionID(r *http.Request, id string) {
+	jsonapi.LogActionID(r, id)
+	getRequestInfo(r).actionID = id
+}
+
+//requestLogger returns the logger for the given request
+func (s *Server) requestLogger(r *http.Request) *logger.Logger {
+	return logger.FromContext(r.Context(), s.Logger)
+}
+
+//validRequestID returns true if id is safe to propagate
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *loggingWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *loggingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.size += n
+	return n, err
+}
+
+//Unwrap returns the underlying http.ResponseWriter so http.ResponseController can reach the connection
+func (w *loggingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//withRequestID returns an http.Handler that assigns the request an ID from the X-Request-ID header,
+//or a new one, and adds a logger with the ID to the request context
+func (s *Server) withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = rand.String(requestIDLength)
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := logger.NewContext(r.Context(), s.Logger.With("request_id", id))
+		ctx = context.WithValue(ctx, contextKeyRequestInfo, new(requestInfo))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+//withAccessLog returns an http.Handler that logs each request
+func (s *Server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := time.Now()
+		lw := &loggingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(lw, r)
+
+		info := getRequestInfo(r)
+		s.requestLogger(r).Info("request",
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"status", lw.status,
+			"size", lw.size,
+			"duration", time.Since(t),
+			"remote_addr", r.RemoteAddr,
+			"user", info.user,
+			"referer", r.Referer(),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+//withRequestInfo returns a jsonapi.ReturnHandlerFunc that records the session user and error for logging
+func withRequestInfo(next jsonapi.ReturnHandlerFunc, auth bool) jsonapi.ReturnHandlerFunc {
+	return func(r *http.Request) (int, interface{}) {
+		if auth {
+			logUser(r, jsonapi.GetSession(r).Username())
+		}
+
+		code, body := next(r)
+		if err, ok := body.(error); ok {
+			getRequestInfo(r).err = err
+		}
+
+		return code, body
+	}
+}
+
+//withAPILog returns an http.Handler that logs API requests and records their latency by action and status
+func (s *Server) withAPILog(a *apiRouter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := "unknown"
+		info := getRequestInfo(r)
+
+		var m mux.RouteMatch
+		if a.actions.Match(r, &m) && m.Route != nil {
+			action = m.Route.GetName()
+			info.actionID = m.Vars["id"]
+		}
+
+		t := time.Now()
+		lw := &loggingWriter{ResponseWriter: w, status: http.StatusOK}
+		a.ServeHTTP(lw, r)
+		d := time.Since(t)
+
+		s.metrics.requests.Observe(d.Seconds(), action, strconv.Itoa(lw.status))
+
+		level := logger.LevelInfo
+		switch {
+		case lw.status >= 500:
+			level = logger.LevelError
+		case lw.status >= 400:
+			level = logger.LevelWarn
+		}
+
+		kv := []interface{}{"action", action, "action_id", info.actionID, "user", info.user, "status", lw.status, "duration", d}
+		if info.err != nil {
+			kv = append(kv, "error", info.err)
+		}
+		s.requestLogger(r).Log(level, "api", kv...)
+	})
+}
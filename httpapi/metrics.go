@@ -0,0 +1,143 @@
+package httpapi
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/httputil/auth"
+	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/httputil/session"
+	"github.com/korylprince/url-shortener-server/v2/metrics"
+)
+
+//authAction is the jsonapi action name of the built-in authentication handler
+const authAction = "github.com/korylprince/httputil/jsonapi.(*APIRouter).authenticate-fm"
+
+//serverMetrics are the metrics collected by the server
+type serverMetrics struct {
+	registry  *metrics.Registry
+	redirects *metrics.CounterVec
+	requests  *metrics.HistogramVec
+	auths     *metrics.CounterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry:  r,
+		redirects: r.NewCounterVec("shortener_redirects_total", "Short URL redirects by result (hit, bot, head, miss, expired, or error).", "result"),
+		requests: r.NewHistogramVec("shortener_api_request_duration_seconds", "API request latency by jsonapi action and status code.",
+			metrics.DefaultBuckets, "action", "code"),
+		auths: r.NewCounterVec("shortener_auth_attempts_total", "Authentication attempts by result (success, failure, or error).", "result"),
+	}
+}
+
+//Metrics returns the registry served at /metrics so other components can register metrics
+func (s *Server) Metrics() *metrics.Registry {
+	return s.metrics.registry
+}
+
+//actionName returns the jsonapi action name for handler
+func actionName(handler jsonapi.ReturnHandlerFunc) string {
+	return runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+}
+
+//apiRouter registers handlers with a jsonapi.APIRouter and records their action names for metrics and logging
+type apiRouter struct {
+	*jsonapi.APIRouter
+	actions *mux.Router
+}
+
+func newAPIRouter(r *jsonapi.APIRouter) *apiRouter {
+	a := &apiRouter{APIRouter: r, actions: mux.NewRouter()}
+	a.actions.Methods("POST").Path("/auth").Name(authAction)
+	return a
+}
+
+//Handle registers a ReturnHandlerFunc with the given parameters
+func (a *apiRouter) Handle(method, path string, handler jsonapi.ReturnHandlerFunc, auth bool) {
+	a.actions.Methods(method).Path(path).Name(actionName(handler))
+	a.APIRouter.Handle(method, path, withRequestInfo(handler, auth), auth)
+}
+
+//countingAuth is an auth.Auth that counts authentication results
+type countingAuth struct {
+	auth.Auth
+	auths *metrics.CounterVec
+}
+
+//Authenticate implements the auth.Auth interface
+func (a *countingAuth) Authenticate(username, password string) (session.Session, error) {
+	sess, err := a.Auth.Authenticate(username, password)
+	switch {
+	case err != nil:
+		a.auths.Inc("error")
+	case sess == nil:
+		a.auths.Inc("failure")
+	default:
+		a.auths.Inc("success")
+	}
+	return sess, err
+}
+
+//countingStore is a session.Store that tracks the number of active sessions.
+//Sessions are considered active until a Read finds them expired or they're unused for expiration
+type countingStore struct {
+	session.Store
+	expiration time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newCountingStore(store session.Store, expiration time.Duration) *countingStore {
+	return &countingStore{Store: store, expiration: expiration, seen: make(map[string]time.Time)}
+}
+
+//Create implements the session.Store interface
+func (s *countingStore) Create(sess session.Session) (string, error) {
+	id, err := s.Store.Create(sess)
+	if err == nil {
+		s.mu.Lock()
+		s.seen[id] = time.Now()
+		s.mu.Unlock()
+	}
+	return id, err
+}
+
+//Read implements the session.Store interface
+func (s *countingStore) Read(id string) (session.Session, error) {
+	sess, err := s.Store.Read(id)
+	if err != nil {
+		return sess, err
+	}
+
+	s.mu.Lock()
+	if sess == nil {
+		delete(s.seen, id)
+	} else {
+		s.seen[id] = time.Now()
+	}
+	s.mu.Unlock()
+
+	return sess, nil
+}
+
+//Active returns the number of active sessions
+func (s *countingStore) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.expiration > 0 {
+		for id, t := range s.seen {
+			if time.Since(t) > s.expiration {
+				delete(s.seen, id)
+			}
+		}
+	}
+
+	return len(s.seen)
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/httputil/auth"
+	"github.com/korylprince/httputil/session"
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var previewTemplate = template.Must(template.ParseFS(templateFS, "templates/preview.html"))
+
+type previewData struct {
+	Title       string
+	ShortURL    string
+	URL         string
+	Host        string
+	LinkTitle   string
+	Description string
+	Owner       string
+	Created     *time.Time
+	Expires     *time.Time
+}
+
+//previewRequested returns true if the request asks for a preview with ?preview
+func previewRequested(r *http.Request) bool {
+	_, ok := r.URL.Query()["preview"]
+	return ok
+}
+
+//internalURL returns true if dest's host is one of InternalDomains or a subdomain of one
+func (s *Server) internalURL(dest string) bool {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range s.InternalDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//previewHandler shows the destination of a URL without redirecting or counting a view
+func (s *Server) previewHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	getRequestInfo(r).actionID = id
+
+	u, err := s.db.Get(id)
+	if err != nil {
+		s.requestLogger(r).Error("Unable to get URL", "id", id, "error", err)
+		s.redirectError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if u == nil || (u.Expires != nil && time.Now().After(*(u.Expires))) {
+		s.redirectError(w, r, http.StatusNotFound)
+		return
+	}
+
+	s.writePreview(w, r, u)
+}
+
+//writePreview renders the preview page for u
+func (s *Server) writePreview(w http.ResponseWriter, r *http.Request, u *db.URL) {
+	data := &previewData{Title: s.AppTitle, ShortURL: s.shortURL(r, u.ID), URL: u.URL, LinkTitle: u.Title,
+		Description: u.Description, Owner: s.displayName(u.User), Created: u.Created, Expires: u.Expires}
+	if data.Title == "" {
+		data.Title = "Link Preview"
+	}
+	if dest, err := url.Parse(u.URL); err == nil {
+		data.Host = dest.Host
+	}
+
+	buf := new(bytes.Buffer)
+	if err := previewTemplate.Execute(buf, data); err != nil {
+		s.requestLogger(r).Error("Unable to render preview", "id", u.ID, "error", err)
+		s.redirectError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if _, err := buf.WriteTo(w); err != nil {
+		s.requestLogger(r).Debug("Unable to write preview", "id", u.ID, "error", err)
+	}
+}
+
+//displayName returns the display name for user, or user if it isn't known
+func (s *Server) displayName(user string) string {
+	name, err := s.db.DisplayName(user)
+	if err != nil {
+		s.Logger.Warn("Unable to get display name", "user", user, "error", err)
+	}
+	if name == "" {
+		return user
+	}
+	return name
+}
+
+//displayNameAuth is an auth.Auth that records the display names of users that log in
+type displayNameAuth struct {
+	auth.Auth
+	s *Server
+}
+
+//Authenticate implements the auth.Auth interface
+func (a *displayNameAuth) Authenticate(username, password string) (session.Session, error) {
+	sess, err := a.Auth.Authenticate(username, password)
+	if err != nil || sess == nil || sess.DisplayName() == "" {
+		return sess, err
+	}
+
+	//avoid a write on every login
+	if name, dErr := a.s.db.DisplayName(sess.Username()); dErr == nil && name == sess.DisplayName() {
+		return sess, err
+	}
+
+	if dErr := a.s.db.SetDisplayName(sess.Username(), sess.DisplayName()); dErr != nil {
+		a.s.Logger.Warn("Unable to set display name", "user", sess.Username(), "error", dErr)
+	}
+
+	return sess, err
+}
@@ -0,0 +1,258 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/qr"
+)
+
+//qrFormats are the supported QR code image formats
+var qrFormats = db.QRFormats
+
+var qrContentTypes = map[string]string{"png": "image/png", "svg": "image/svg+xml"}
+
+const (
+	defaultQRSize   = 256
+	minQRSize       = 32
+	maxQRSize       = 2048
+	defaultQRMargin = 4
+	maxQRMargin     = 16
+)
+
+//qrMaxAge is how long clients and proxies may cache QR codes. The encoded short URL doesn't change, so it can be long
+const qrMaxAge = 24 * time.Hour
+
+//qrOptions are the rendering options for a QR code
+type qrOptions struct {
+	format string
+	size   int
+	level  qr.Level
+	fg     color.Color
+	bg     color.Color
+	margin int
+}
+
+//parseQROptions parses QR code options from the query string. If custom is false, only size and ecc are used
+func parseQROptions(q url.Values, format string, custom bool) (*qrOptions, error) {
+	opts := &qrOptions{format: format, size: defaultQRSize, level: qr.M, fg: color.Black, bg: color.White, margin: defaultQRMargin}
+
+	if opts.format == "" {
+		opts.format = strings.ToLower(q.Get("format"))
+		if opts.format == "" {
+			opts.format = "png"
+		}
+	}
+	if _, ok := qrContentTypes[opts.format]; !ok {
+		return nil, fmt.Errorf("Invalid format: %s", opts.format)
+	}
+
+	if s := q.Get("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			return nil, fmt.Errorf("Invalid size %s: must be between %d and %d", s, minQRSize, maxQRSize)
+		}
+		opts.size = size
+	}
+
+	if s := q.Get("ecc"); s != "" {
+		level, err := qr.ParseLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ecc %s: must be L, M, Q, or H", s)
+		}
+		opts.level = level
+	}
+
+	if !custom {
+		return opts, nil
+	}
+
+	for _, c := range []struct {
+		param string
+		col   *color.Color
+	}{{"fg", &opts.fg}, {"bg", &opts.bg}} {
+		if s := q.Get(c.param); s != "" {
+			col, err := parseColor(s)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s %s: %v", c.param, s, err)
+			}
+			*c.col = col
+		}
+	}
+
+	if s := q.Get("margin"); s != "" {
+		margin, err := strconv.Atoi(s)
+		if err != nil || margin < 0 || margin > maxQRMargin {
+			return nil, fmt.Errorf("Invalid margin %s: must be between 0 and %d", s, maxQRMargin)
+		}
+		opts.margin = margin
+	}
+
+	return opts, nil
+}
+
+//parseColor parses a hex color in the form RGB, RRGGBB, or RRGGBBAA, with an optional leading #
+func parseColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return nil, errors.New("must be in the form RGB, RRGGBB, or RRGGBBAA")
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid hex")
+	}
+
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}, nil
+}
+
+//colorHex returns col in RRGGBBAA form
+func colorHex(col color.Color) string {
+	n := color.NRGBAModel.Convert(col).(color.NRGBA)
+	return fmt.Sprintf("%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+//writeQR writes a QR code for the short URL for id
+func (s *Server) writeQR(w http.ResponseWriter, r *http.Request, id string, opts *qrOptions, cacheControl string) {
+	short := s.shortURL(r, id)
+
+	code, err := qr.Encode([]byte(short), opts.level)
+	if err != nil {
+		s.requestLogger(r).Error("Unable to encode QR code", "id", id, "error", err)
+		s.writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	//smaller images would need to drop modules and couldn't be scanned
+	if width := code.Width(opts.margin); opts.size < width {
+		s.requestLogger(r).Debug("Invalid QR code request", "id", id, "error",
+			fmt.Errorf("Invalid size %d: must be at least %d for this URL and margin", opts.size, width))
+		s.writeError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if opts.format == "svg" {
+		err = code.SVG(buf, opts.size, opts.margin, opts.fg, opts.bg)
+	} else {
+		err = code.PNG(buf, opts.size, opts.margin, opts.fg, opts.bg)
+	}
+	if err != nil {
+		s.requestLogger(r).Error("Unable to render QR code", "id", id, "format", opts.format, "error", err)
+		s.writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	//the image only depends on the short URL and options, so they make a stable ETag
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%d\n%v\n%s\n%s\n%d",
+		short, opts.format, opts.size, opts.level, colorHex(opts.fg), colorHex(opts.bg), opts.margin)))
+
+	w.Header().Set("Content-Type", qrContentTypes[opts.format])
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sum[:16]))
+
+	//ServeContent handles If-None-Match and HEAD requests
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+//publicQRHandler serves QR codes for active URLs at /{id}.png and /{id}.svg
+func (s *Server) publicQRHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, format := vars["id"], vars["format"]
+	getRequestInfo(r).actionID = id
+
+	//URLs created before QR codes were added may end in an image extension
+	if u, err := s.db.Get(id + "." + format); err == nil && u != nil {
+		s.withRedirect(s.viewHandler).ServeHTTP(w, mux.SetURLVars(r, map[string]string{"id": id + "." + format}))
+		return
+	}
+
+	opts, err := parseQROptions(r.URL.Query(), format, false)
+	if err != nil {
+		s.requestLogger(r).Debug("Invalid QR code request", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := s.db.Get(id)
+	if err != nil {
+		s.requestLogger(r).Error("Unable to get URL", "id", id, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if u == nil || (u.Expires != nil && time.Now().After(*(u.Expires))) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	s.writeQR(w, r, u.ID, opts, fmt.Sprintf("public, max-age=%d", int(qrMaxAge.Seconds())))
+}
+
+//qrHandler serves QR codes with custom options to URL owners and admins
+func (s *Server) qrHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	getRequestInfo(r).actionID = id
+	log := s.requestLogger(r)
+
+	sess, code, err := s.checkSession(r)
+	if err != nil {
+		log.Warn("QR code request denied", "id", id, "status", code, "error", err)
+		s.writeError(w, r, code)
+		return
+	}
+	user := sess.Username()
+
+	u, err := s.db.Get(id)
+	if err != nil {
+		log.Error("Unable to get URL", "id", id, "error", err)
+		s.writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if u == nil {
+		s.writeError(w, r, http.StatusNotFound)
+		return
+	}
+
+	//aliases and other cases of the ID use the URL they resolve to
+	ok, err := s.checkRights(sess, user, u.ID)
+	if err != nil {
+		log.Error("Unable to check rights", "user", user, "id", u.ID, "error", err)
+		s.writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		log.Warn("QR code request denied", "id", u.ID, "status", http.StatusForbidden, "error",
+			fmt.Errorf("User %s does not have permission to read URL %s", user, u.ID))
+		s.writeError(w, r, http.StatusForbidden)
+		return
+	}
+
+	opts, err := parseQROptions(r.URL.Query(), "", true)
+	if err != nil {
+		log.Debug("Invalid QR code request", "id", id, "error", err)
+		s.writeError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	s.writeQR(w, r, u.ID, opts, fmt.Sprintf("private, max-age=%d", int(qrMaxAge.Seconds())))
+}
@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korylprince/httputil/session/memory"
+)
+
+func TestWriteQRSize(t *testing.T) {
+	s := NewServer("", nil, nil, "", memory.New(time.Minute), nil, io.Discard)
+	s.PublicURL = "https://short.example.com"
+
+	//a long ID needs more modules than the smallest size allows
+	long := strings.Repeat("a", 100)
+
+	tests := []struct {
+		id     string
+		size   int
+		margin int
+		code   int
+	}{
+		{"poster", minQRSize, 0, http.StatusOK},
+		{"poster", minQRSize, defaultQRMargin, http.StatusBadRequest},
+		{"poster", defaultQRSize, defaultQRMargin, http.StatusOK},
+		{long, minQRSize, defaultQRMargin, http.StatusBadRequest},
+		{long, minQRSize, 0, http.StatusBadRequest},
+		{long, defaultQRSize, defaultQRMargin, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		for _, format := range []string{"png", "svg"} {
+			opts, err := parseQROptions(nil, format, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.size, opts.margin = test.size, test.margin
+
+			w := httptest.NewRecorder()
+			s.writeQR(w, httptest.NewRequest("GET", "/"+test.id+"."+format, nil), test.id, opts, "no-cache")
+			if w.Code != test.code {
+				t.Errorf("%d character ID, size %d, margin %d, %s: expected status %d, got %d",
+					len(test.id), test.size, test.margin, format, test.code, w.Code)
+				continue
+			}
+			if w.Code != http.StatusOK || format != "png" {
+				continue
+			}
+
+			img, err := png.Decode(w.Body)
+			if err != nil {
+				t.Errorf("%d character ID, size %d: unable to decode PNG: %v", len(test.id), test.size, err)
+			} else if b := img.Bounds(); b.Dx() != test.size {
+				t.Errorf("%d character ID: expected %d pixel PNG, got %d", len(test.id), test.size, b.Dx())
+			}
+		}
+	}
+}
@@ -1,33 +1,75 @@
 package httpapi
 
 import (
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 
+	"github.com/gorilla/mux"
 	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/url-shortener-server/v2/bot"
+	"github.com/korylprince/url-shortener-server/v2/logger"
 )
 
-func withRedirect(next jsonapi.ReturnHandlerFunc) http.Handler {
+//redirectError redirects to the error page for the given status code
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, code int) {
+	u := &url.URL{Path: "error.html"}
+	v := make(url.Values)
+	v.Set("statusCode", strconv.Itoa(code))
+	v.Set("statusText", http.StatusText(code))
+	u.RawQuery = v.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+}
+
+func (s *Server) withRedirect(next jsonapi.ReturnHandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if previewRequested(r) {
+			s.previewHandler(w, r)
+			return
+		}
+
 		code, body := next(r)
 
 		if code == http.StatusOK {
-			http.Redirect(w, r, body.(string), http.StatusTemporaryRedirect)
+			dest := body.(string)
+			id := mux.Vars(r)["id"]
+
+			//chat apps get a page describing the destination instead of the destination itself
+			if bot.IsUnfurler(r.UserAgent()) {
+				u, err := s.db.Get(id)
+				if err == nil && u != nil && s.writeUnfurl(w, r, u) {
+					return
+				}
+				if err != nil {
+					s.requestLogger(r).Error("Unable to get URL for unfurl", "id", id, "error", err)
+				}
+			}
+
+			//the view has already been counted, so the interstitial links straight to the destination
+			if s.PreviewExternal && !s.internalURL(dest) {
+				u, err := s.db.Get(id)
+				if err == nil && u != nil {
+					s.writePreview(w, r, u)
+					return
+				}
+				if err != nil {
+					s.requestLogger(r).Error("Unable to get URL for interstitial", "id", id, "error", err)
+				}
+			}
+
+			http.Redirect(w, r, dest, http.StatusTemporaryRedirect)
 			return
 		}
 
 		if err, ok := body.(error); ok {
-			log.Printf("Redirecting error (%d %s): %v\n", code, http.StatusText(code), err)
+			level := logger.LevelDebug
+			if code >= 500 {
+				level = logger.LevelError
+			}
+			s.requestLogger(r).Log(level, "Redirecting error", "status", code, "error", err)
 		}
 
-		u := &url.URL{Path: "error.html"}
-		v := make(url.Values)
-		v.Set("statusCode", strconv.Itoa(code))
-		v.Set("statusText", http.StatusText(code))
-		u.RawQuery = v.Encode()
-
-		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+		s.redirectError(w, r, code)
 	})
 }
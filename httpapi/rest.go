@@ -6,24 +6,44 @@ import (
 	"fmt"
 	"net/http"
 	neturl "net/url"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/korylprince/httputil/auth/ad"
 	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/httputil/session"
+	"github.com/korylprince/url-shortener-server/v2/bot"
 	"github.com/korylprince/url-shortener-server/v2/db"
 )
 
-func (s *Server) hasRights(r *http.Request, username, id string) (bool, error) {
-	session := jsonapi.GetSession(r)
-	user := session.(*ad.User)
+func (s *Server) isAdmin(sess session.Session) bool {
+	user, ok := sess.(*ad.User)
+	if !ok {
+		return false
+	}
+
 	for _, g := range user.Groups {
 		if g == s.adminGroup {
-			return true, nil
+			return true
 		}
 	}
 
+	return false
+}
+
+func (s *Server) hasRights(r *http.Request, username, id string) (bool, error) {
+	return s.checkRights(jsonapi.GetSession(r), username, id)
+}
+
+//checkRights returns true if the session is an admin or username owns the URL with the given id or alias
+func (s *Server) checkRights(sess session.Session, username, id string) (bool, error) {
+	if s.isAdmin(sess) {
+		return true, nil
+	}
+
 	urls, err := s.db.URLs(username)
 	if err != nil {
 		return false, fmt.Errorf("Unable to get URLs for user %s: %v", username, err)
@@ -34,6 +54,11 @@ func (s *Server) hasRights(r *http.Request, username, id string) (bool, error) {
 		if url.ID == id {
 			owned = true
 		}
+		for _, alias := range url.Aliases {
+			if alias == id {
+				owned = true
+			}
+		}
 	}
 
 	return owned, nil
@@ -45,16 +70,6 @@ func (s *Server) getHandler(r *http.Request) (int, interface{}) {
 	session := jsonapi.GetSession(r)
 	user := session.Username()
 
-	//check user has rights to url
-	ok, err := s.hasRights(r, user, id)
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("Unable to check if user %s is has rights for URL %s: %v", user, id, err)
-	}
-
-	if !ok {
-		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to read URL %s", user, id)
-	}
-
 	//read url
 	url, err := s.db.Get(id)
 	if err != nil {
@@ -65,14 +80,28 @@ func (s *Server) getHandler(r *http.Request) (int, interface{}) {
 		return http.StatusNotFound, fmt.Errorf("URL %s does not exist", id)
 	}
 
-	jsonapi.LogActionID(r, url.ID)
+	//aliases and other cases of the ID read the URL they resolve to
+	id = url.ID
+
+	//check user has rights to url
+	ok, err := s.hasRights(r, user, id)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to check if user %s is has rights for URL %s: %v", user, id, err)
+	}
+
+	if !ok {
+		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to read URL %s", user, id)
+	}
+
+	logActionID(r, url.ID)
 
 	return http.StatusOK, url
 }
 
 func (s *Server) putHandler(r *http.Request) (int, interface{}) {
 	type response struct {
-		URLID string `json:"url_id"`
+		URLID    string `json:"url_id"`
+		Existing bool   `json:"existing,omitempty"`
 	}
 
 	url := new(db.URL)
@@ -82,17 +111,33 @@ func (s *Server) putHandler(r *http.Request) (int, interface{}) {
 		return http.StatusBadRequest, fmt.Errorf("Unable to decode request body: %v", err)
 	}
 
-	if _, err := neturl.ParseRequestURI(url.URL); err != nil {
-		return http.StatusBadRequest, fmt.Errorf(`Unable to parse url "%s": %v`, url.URL, err)
-	}
-
-	if url.ID != "" && !regexp.MustCompile(allowedIDRegexp).MatchString(url.ID) {
-		return http.StatusBadRequest, fmt.Errorf(`URL ID %s not valid`, url.ID)
+	url.ID = s.normalizeID(url.ID)
+	if err := db.ValidateURL(url); err != nil {
+		if strings.Contains(err.Error(), "is reserved") {
+			return http.StatusConflict, err
+		}
+		return http.StatusBadRequest, err
 	}
 
 	session := jsonapi.GetSession(r)
 	user := session.Username()
 
+	//return the user's unexpired URL with the same destination instead of creating a random ID
+	if url.ID == "" && r.FormValue("reuse_existing") == "true" {
+		existing, err := s.db.DestinationURLs(user, url.URL)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf(`Unable to get URLs for destination "%s": %v`, url.URL, err)
+		}
+
+		sortCreated(existing, false)
+		for _, u := range existing {
+			if u.Expires == nil || time.Now().Before(*(u.Expires)) {
+				logActionID(r, u.ID)
+				return http.StatusOK, &response{URLID: u.ID, Existing: true}
+			}
+		}
+	}
+
 	id, err := s.db.Put(url, user)
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
@@ -102,7 +147,10 @@ func (s *Server) putHandler(r *http.Request) (int, interface{}) {
 		return http.StatusInternalServerError, fmt.Errorf(`Unable to put URL "%s": %v`, url.URL, err)
 	}
 
-	jsonapi.LogActionID(r, url.ID)
+	logActionID(r, url.ID)
+
+	s.notify(r, db.EventCreated, url, user)
+	s.queueUnfurl(id)
 
 	return http.StatusOK, &response{URLID: id}
 }
@@ -122,6 +170,9 @@ func (s *Server) updateHandler(r *http.Request) (int, interface{}) {
 		return http.StatusNotFound, fmt.Errorf("URL %s does not exist", id)
 	}
 
+	//aliases and other cases of the ID update the URL they resolve to
+	id = url.ID
+
 	//read url from body
 	url = new(db.URL)
 	d := json.NewDecoder(r.Body)
@@ -130,12 +181,16 @@ func (s *Server) updateHandler(r *http.Request) (int, interface{}) {
 		return http.StatusBadRequest, fmt.Errorf("Unable to decode request body: %v", err)
 	}
 
-	jsonapi.LogActionID(r, url.ID)
+	logActionID(r, url.ID)
 
 	if _, err = neturl.ParseRequestURI(url.URL); err != nil {
 		return http.StatusBadRequest, fmt.Errorf(`Unable to parse url "%s": %v`, url.URL, err)
 	}
 
+	if err = db.NormalizeURL(url); err != nil {
+		return http.StatusBadRequest, err
+	}
+
 	//check user has rights to url
 	ok, err := s.hasRights(r, user, id)
 	if err != nil {
@@ -147,7 +202,7 @@ func (s *Server) updateHandler(r *http.Request) (int, interface{}) {
 	}
 
 	//update url
-	if err = s.db.Update(id, url); err != nil {
+	if err = s.db.Update(id, url, user); err != nil {
 		return http.StatusInternalServerError, fmt.Errorf("Unable to update URL %s: %v", id, err)
 	}
 
@@ -160,6 +215,13 @@ func (s *Server) updateHandler(r *http.Request) (int, interface{}) {
 		return http.StatusInternalServerError, fmt.Errorf("Unable to get URL %s: %v", id, err)
 	}
 
+	s.notify(r, db.EventUpdated, url, user)
+
+	//only refetch if the destination changed
+	if url.Unfurl == nil || url.Unfurl.URL != url.URL {
+		s.queueUnfurl(id)
+	}
+
 	return http.StatusOK, url
 }
 
@@ -178,6 +240,9 @@ func (s *Server) deleteHandler(r *http.Request) (int, interface{}) {
 		return http.StatusNotFound, fmt.Errorf("URL %s does not exist", id)
 	}
 
+	//aliases and other cases of the ID delete the URL they resolve to
+	id = url.ID
+
 	//check user has rights to url
 	ok, err := s.hasRights(r, user, id)
 	if err != nil {
@@ -188,22 +253,134 @@ func (s *Server) deleteHandler(r *http.Request) (int, interface{}) {
 		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to delete URL %s", user, id)
 	}
 
-	jsonapi.LogActionID(r, url.ID)
+	logActionID(r, url.ID)
 
 	//delete url
-	if err := s.db.Delete(id); err != nil {
+	if err := s.db.Delete(id, user); err != nil {
 		return http.StatusInternalServerError, fmt.Errorf("Unable to delete URL %s: %v", id, err)
 	}
 
+	s.notify(r, db.EventDeleted, url, user)
+
 	return http.StatusOK, nil
 }
 
+//aliasRequest reads the alias from the body of a request to change the aliases of the URL in the path,
+//returning the URL, or an error and status code if the URL doesn't exist or the user doesn't have rights to it
+func (s *Server) aliasRequest(r *http.Request) (*db.URL, string, int, error) {
+	type request struct {
+		Alias string `json:"alias"`
+	}
+
+	id := mux.Vars(r)["id"]
+	session := jsonapi.GetSession(r)
+	user := session.Username()
+
+	url, err := s.db.Get(id)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, fmt.Errorf("Unable to get URL %s: %v", id, err)
+	}
+
+	if url == nil {
+		return nil, "", http.StatusNotFound, fmt.Errorf("URL %s does not exist", id)
+	}
+
+	ok, err := s.hasRights(r, user, url.ID)
+	if err != nil {
+		return nil, "", http.StatusInternalServerError, fmt.Errorf("Unable to check if user %s is has rights for URL %s: %v", user, url.ID, err)
+	}
+
+	if !ok {
+		return nil, "", http.StatusForbidden, fmt.Errorf("User %s does not have permission to update URL %s", user, url.ID)
+	}
+
+	req := new(request)
+	if err = json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("Unable to decode request body: %v", err)
+	}
+
+	logActionID(r, url.ID)
+
+	return url, req.Alias, http.StatusOK, nil
+}
+
+func (s *Server) addAliasHandler(r *http.Request) (int, interface{}) {
+	url, alias, code, err := s.aliasRequest(r)
+	if err != nil {
+		return code, err
+	}
+
+	if !validIDRegexp.MatchString(alias) {
+		return http.StatusBadRequest, fmt.Errorf(`Alias "%s" not valid`, alias)
+	}
+
+	if db.ReservedID(s.normalizeID(alias)) {
+		return http.StatusConflict, fmt.Errorf("URL ID %s is reserved", alias)
+	}
+
+	user := jsonapi.GetSession(r).Username()
+	if err = s.db.AddAlias(url.ID, alias); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return http.StatusConflict, err
+		}
+
+		return http.StatusInternalServerError, fmt.Errorf("Unable to add alias %s to URL %s: %v", alias, url.ID, err)
+	}
+
+	return s.aliasResponse(r, url.ID, user)
+}
+
+func (s *Server) removeAliasHandler(r *http.Request) (int, interface{}) {
+	url, alias, code, err := s.aliasRequest(r)
+	if err != nil {
+		return code, err
+	}
+
+	found := ""
+	for _, a := range url.Aliases {
+		if a == alias {
+			found = a
+			break
+		}
+		if s.CaseInsensitiveIDs && strings.EqualFold(a, alias) {
+			found = a
+		}
+	}
+
+	if found == "" {
+		return http.StatusNotFound, fmt.Errorf("Alias %s for URL %s does not exist", alias, url.ID)
+	}
+	alias = found
+
+	user := jsonapi.GetSession(r).Username()
+	if err = s.db.RemoveAlias(url.ID, alias); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to remove alias %s from URL %s: %v", alias, url.ID, err)
+	}
+
+	return s.aliasResponse(r, url.ID, user)
+}
+
+//aliasResponse returns the URL with the given id after its aliases were changed by user
+func (s *Server) aliasResponse(r *http.Request, id, user string) (int, interface{}) {
+	url, err := s.db.Get(id)
+	if err != nil || url == nil {
+		if err == nil {
+			err = errors.New("URL unexpectedly nil")
+		}
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get URL %s: %v", id, err)
+	}
+
+	s.notify(r, db.EventUpdated, url, user)
+
+	return http.StatusOK, url
+}
+
 func (s *Server) titleHandler(r *http.Request) (int, interface{}) {
 	type response struct {
 		AppTitle string `json:"app_title"`
 	}
 
-	jsonapi.LogActionID(r, s.AppTitle)
+	logActionID(r, s.AppTitle)
 	return http.StatusOK, &response{AppTitle: s.AppTitle}
 }
 
@@ -212,40 +389,200 @@ func (s *Server) urlsHandler(r *http.Request) (int, interface{}) {
 		URLs []*db.URL `json:"urls"`
 	}
 
-	admin := false
 	session := jsonapi.GetSession(r)
 	username := session.Username()
-	user := session.(*ad.User)
-	for _, g := range user.Groups {
-		if g == s.adminGroup {
-			admin = true
-			break
-		}
-	}
 
-	if admin && r.FormValue("all") == "true" {
+	if s.isAdmin(session) && r.FormValue("all") == "true" {
 		username = ""
 	}
 
-	urls, err := s.db.URLs(username)
+	var after, before time.Time
+	if v := r.FormValue("created_after"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf(`Unable to parse created_after "%s": %v`, v, err)
+		}
+		after = t
+	}
+	if v := r.FormValue("created_before"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf(`Unable to parse created_before "%s": %v`, v, err)
+		}
+		before = t
+	}
+
+	tag := strings.ToLower(strings.TrimSpace(r.FormValue("tag")))
+	destination := r.FormValue("destination")
+
+	var urls []*db.URL
+	var err error
+	switch {
+	case destination != "":
+		urls, err = s.db.DestinationURLs(username, destination)
+	case tag != "":
+		urls, err = s.db.TaggedURLs(username, tag)
+	default:
+		urls, err = s.db.URLs(username)
+	}
 	if err != nil {
 		return http.StatusInternalServerError, fmt.Errorf("Unable to get URLs for user %s: %v", username, err)
 	}
 
+	if destination != "" && tag != "" {
+		filtered := make([]*db.URL, 0, len(urls))
+		for _, u := range urls {
+			for _, t := range u.Tags {
+				if t == tag {
+					filtered = append(filtered, u)
+					break
+				}
+			}
+		}
+		urls = filtered
+	}
+
+	if !after.IsZero() || !before.IsZero() {
+		filtered := make([]*db.URL, 0, len(urls))
+		for _, u := range urls {
+			if u.Created == nil || (!after.IsZero() && u.Created.Before(after)) || (!before.IsZero() && !u.Created.Before(before)) {
+				continue
+			}
+			filtered = append(filtered, u)
+		}
+		urls = filtered
+	}
+
+	if r.FormValue("sort") == "created" {
+		sortCreated(urls, true)
+	}
+
 	return http.StatusOK, &response{URLs: urls}
 }
 
+//sortCreated sorts urls by creation time, newest first if newest is true or oldest first otherwise.
+//URLs without a creation time are last
+func sortCreated(urls []*db.URL, newest bool) {
+	sort.SliceStable(urls, func(i, j int) bool {
+		if urls[i].Created == nil || urls[j].Created == nil {
+			return urls[j].Created == nil && urls[i].Created != nil
+		}
+		if newest {
+			return urls[i].Created.After(*(urls[j].Created))
+		}
+		return urls[i].Created.Before(*(urls[j].Created))
+	})
+}
+
+//defaultSearchLimit and maxSearchLimit are the default and maximum number of search results returned
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+func (s *Server) searchHandler(r *http.Request) (int, interface{}) {
+	type response struct {
+		Results []*db.SearchResult `json:"results"`
+	}
+
+	session := jsonapi.GetSession(r)
+	username := session.Username()
+
+	if s.isAdmin(session) && r.FormValue("all") == "true" {
+		username = ""
+	}
+
+	query := r.FormValue("q")
+	if strings.TrimSpace(query) == "" {
+		return http.StatusBadRequest, errors.New("Search query is empty")
+	}
+
+	limit := defaultSearchLimit
+	if v := r.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxSearchLimit {
+			return http.StatusBadRequest, fmt.Errorf(`Invalid limit "%s"`, v)
+		}
+		limit = l
+	}
+
+	results, err := s.db.Search(username, query, limit)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to search URLs for user %s: %v", username, err)
+	}
+
+	logActionID(r, query)
+
+	return http.StatusOK, &response{Results: results}
+}
+
+func (s *Server) tagsHandler(r *http.Request) (int, interface{}) {
+	type tag struct {
+		Tag   string `json:"tag"`
+		Count int    `json:"count"`
+	}
+
+	type response struct {
+		Tags []*tag `json:"tags"`
+	}
+
+	session := jsonapi.GetSession(r)
+	username := session.Username()
+
+	if s.isAdmin(session) && r.FormValue("all") == "true" {
+		username = ""
+	}
+
+	counts, err := s.db.Tags(username)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get tags for user %s: %v", username, err)
+	}
+
+	tags := make([]*tag, 0, len(counts))
+	for t, n := range counts {
+		tags = append(tags, &tag{Tag: t, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	return http.StatusOK, &response{Tags: tags}
+}
+
 func (s *Server) viewHandler(r *http.Request) (int, interface{}) {
 	id := mux.Vars(r)["id"]
 
-	url, err := s.db.View(id)
+	//HEAD requests resolve without counting a view, and bots are counted separately
+	result := "hit"
+	var url string
+	var err error
+	switch {
+	case r.Method == http.MethodHead:
+		result = "head"
+		url, err = s.db.Resolve(id)
+	case s.Bots != nil && s.Bots.Match(r.UserAgent(), bot.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"), s.TrustedProxies)):
+		result = "bot"
+		if url, err = s.db.Resolve(id); err == nil && url != "" {
+			err = s.db.CountBotView(id)
+		}
+	default:
+		url, err = s.db.View(id)
+	}
+	if err == db.ErrExpired {
+		s.metrics.redirects.Inc("expired")
+		return http.StatusNotFound, fmt.Errorf("URL %s doesn't exist", id)
+	}
 	if err != nil {
+		s.metrics.redirects.Inc("error")
 		return http.StatusInternalServerError, fmt.Errorf("Unable to get URL %s: %v", id, err)
 	}
 
 	if url == "" {
+		s.metrics.redirects.Inc("miss")
 		return http.StatusNotFound, fmt.Errorf("URL %s doesn't exist", id)
 	}
 
+	s.metrics.redirects.Inc(result)
+
 	return http.StatusOK, url
 }
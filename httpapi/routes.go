@@ -2,16 +2,26 @@ package httpapi
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/korylprince/httputil/auth/ad"
 	"github.com/korylprince/httputil/jsonapi"
 	"github.com/korylprince/httputil/session"
+	"github.com/korylprince/url-shortener-server/v2/db"
 )
 
-const allowedIDRegexp = "[a-zA-Z0-9_\\-.]+"
+const allowedIDRegexp = db.IDRegexp
+
+//normalizeID returns id lowercased if CaseInsensitiveIDs is set
+func (s *Server) normalizeID(id string) string {
+	if s.CaseInsensitiveIDs {
+		return strings.ToLower(id)
+	}
+	return id
+}
 
 //API is the current API version
 const API = "1.1"
@@ -34,19 +44,68 @@ func (s *Server) Router() http.Handler {
 		return true, attrs, nil
 	}
 
-	apirouter := jsonapi.New(s.output, s.auth, s.sessionStore, hook)
-	r.PathPrefix(apiPath).Handler(http.StripPrefix(apiPath, apirouter))
+	s.sessions.expiration = s.SessionExpiration
+
+	//API requests are logged by withAPILog
+	apirouter := newAPIRouter(jsonapi.New(io.Discard, s.auth, s.sessionStore, hook))
+	api := http.StripPrefix(apiPath, s.withAPILog(apirouter))
+
+	r.Methods("GET").Path(apiPath + "/admin/backup").Handler(s.withAdmin(s.backupHandler))
+	//registered before the QR route so /urls/available/qr checks the ID "qr"
+	r.Methods("GET").PathPrefix(apiPath + "/urls/available/").Handler(api)
+	r.Methods("GET").Path(fmt.Sprintf("%s/urls/{id:%s}/qr", apiPath, allowedIDRegexp)).HandlerFunc(s.qrHandler)
+	r.PathPrefix(apiPath).Handler(api)
+
+	apirouter.Handle("GET", "/urls/available/{id}", s.availableHandler, true)
 
 	apirouter.Handle("GET", fmt.Sprintf("/urls/{id:%s}", allowedIDRegexp), s.getHandler, true)
 	apirouter.Handle("POST", "/urls", s.putHandler, true)
 	apirouter.Handle("PUT", fmt.Sprintf("/urls/{id:%s}", allowedIDRegexp), s.updateHandler, true)
 	apirouter.Handle("DELETE", fmt.Sprintf("/urls/{id:%s}", allowedIDRegexp), s.deleteHandler, true)
+	apirouter.Handle("POST", fmt.Sprintf("/urls/{id:%s}/aliases", allowedIDRegexp), s.addAliasHandler, true)
+	apirouter.Handle("DELETE", fmt.Sprintf("/urls/{id:%s}/aliases", allowedIDRegexp), s.removeAliasHandler, true)
 	apirouter.Handle("GET", "/title", s.titleHandler, false)
 	apirouter.Handle("GET", "/urls", s.urlsHandler, true)
+	apirouter.Handle("GET", "/tags", s.tagsHandler, true)
+	apirouter.Handle("GET", "/search", s.searchHandler, true)
+	apirouter.Handle("GET", "/signature", s.signatureHandler, true)
+	apirouter.Handle("POST", "/signature", s.signatureHandler, true)
+
+	apirouter.Handle("POST", "/admin/import", s.importHandler, true)
+	apirouter.Handle("GET", "/admin/cache", s.cacheHandler, true)
+	apirouter.Handle("GET", "/admin/duplicates", s.duplicatesHandler, true)
+	apirouter.Handle("GET", "/admin/webhooks", s.webhooksHandler, true)
+	apirouter.Handle("POST", "/admin/webhooks", s.addWebhookHandler, true)
+	apirouter.Handle("GET", "/admin/webhooks/deliveries", s.deliveriesHandler, true)
+	apirouter.Handle("DELETE", "/admin/webhooks/{id:[a-zA-Z0-9]+}", s.deleteWebhookHandler, true)
+
+	if s.YOURLSAPI {
+		r.Methods("GET", "POST").Path("/yourls-api.php").HandlerFunc(s.yourlsHandler)
+	}
 
 	r.Path("/error.html").Handler(http.FileServer(http.FS(s.files)))
-	r.Methods("GET").Path(fmt.Sprintf("/{id:%s}", allowedIDRegexp)).Handler(withRedirect(s.viewHandler))
+	r.Methods("GET").Path(fmt.Sprintf("/{id:%s}.{format:%s}", allowedIDRegexp, strings.Join(qrFormats, "|"))).HandlerFunc(s.publicQRHandler)
+	r.Methods("GET").Path(fmt.Sprintf("/{id:%s}+", allowedIDRegexp)).HandlerFunc(s.previewHandler)
+	r.Methods("GET", "HEAD").Path(fmt.Sprintf("/{id:%s}", allowedIDRegexp)).Handler(s.withRedirect(s.viewHandler))
 	r.PathPrefix("/").Handler(http.FileServer(http.FS(s.files)))
 
-	return handlers.CombinedLoggingHandler(s.output, r)
+	logged := s.withAccessLog(r)
+
+	//probes and scrapes are frequent, so skip the access log
+	return s.withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			switch r.URL.Path {
+			case "/metrics":
+				s.metrics.registry.ServeHTTP(w, r)
+				return
+			case "/healthz":
+				s.healthzHandler(w, r)
+				return
+			case "/readyz":
+				s.readyzHandler(w, r)
+				return
+			}
+		}
+		logged.ServeHTTP(w, r)
+	}))
 }
@@ -3,24 +3,110 @@ package httpapi
 import (
 	"io"
 	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/korylprince/httputil/auth"
 	"github.com/korylprince/httputil/session"
+	"github.com/korylprince/url-shortener-server/v2/bot"
 	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/logger"
+	"github.com/korylprince/url-shortener-server/v2/unfurl"
+	"github.com/korylprince/url-shortener-server/v2/webhook"
 )
 
 //Server represents shared resources
 type Server struct {
-	AppTitle     string
+	AppTitle string
+
+	//YOURLSAPI enables the YOURLS-compatible API at /yourls-api.php
+	YOURLSAPI bool
+
+	//CaseInsensitiveIDs lowercases custom IDs and aliases before they're checked, as the database does when
+	//it's configured for case-insensitive IDs
+	CaseInsensitiveIDs bool
+
+	//Logger is used for access, API, and error logs. It defaults to JSON lines at the info level written to output
+	Logger *logger.Logger
+
+	//PublicURL is the external base URL short URLs are built from, e.g. https://go.example.com.
+	//If empty, it's derived from the request's Host and X-Forwarded-Proto headers
+	PublicURL string
+
+	//PreviewExternal shows a preview page instead of redirecting to destinations outside of InternalDomains
+	PreviewExternal bool
+
+	//InternalDomains are the domains (and their subdomains) redirected to without a preview when PreviewExternal is set
+	InternalDomains []string
+
+	//Bots classifies requests from crawlers and link unfurlers. Their redirects are counted as bot views
+	//instead of views. Bot detection is disabled if nil
+	Bots *bot.Classifier
+
+	//TrustedProxies are the networks of reverse proxies whose X-Forwarded-For header is used for the client address
+	//Bots matches networks against. If empty, the connecting address is used
+	TrustedProxies []*net.IPNet
+
+	//Unfurl fetches destination metadata for the pages served to link unfurlers. Fetching is disabled if nil
+	Unfurl *unfurl.Worker
+
+	//Webhooks sends webhook events for URL changes. Webhooks are disabled if nil
+	Webhooks *webhook.Dispatcher
+
+	//Version is reported by /readyz
+	Version string
+
+	//LDAPCheckAddr is the host:port of the LDAP server checked by /readyz. The check is skipped if empty
+	LDAPCheckAddr string
+
+	//ReadyTimeout is the timeout for /readyz checks
+	ReadyTimeout time.Duration
+
+	//SessionExpiration is the session store's expiration, used to count active sessions
+	SessionExpiration time.Duration
+
 	db           db.DB
 	auth         auth.Auth
 	adminGroup   string
 	sessionStore session.Store
 	files        fs.FS
-	output       io.Writer
+	started      time.Time
+	metrics      *serverMetrics
+	sessions     *countingStore
 }
 
 //NewServer returns a new server with the given resources
 func NewServer(title string, db db.DB, auth auth.Auth, adminGroup string, sessionStore session.Store, files fs.FS, output io.Writer) *Server {
-	return &Server{AppTitle: title, db: db, auth: auth, adminGroup: adminGroup, sessionStore: sessionStore, files: files, output: output}
+	m := newServerMetrics()
+	sessions := newCountingStore(sessionStore, 0)
+	s := &Server{AppTitle: title, db: db, adminGroup: adminGroup,
+		sessionStore: sessions, files: files, Logger: logger.New(output, logger.LevelInfo, logger.FormatJSON),
+		started: time.Now(), metrics: m, sessions: sessions}
+	s.auth = &countingAuth{Auth: &displayNameAuth{Auth: auth, s: s}, auths: m.auths}
+
+	m.registry.GaugeFunc("shortener_active_sessions", "Number of active sessions.", func() float64 {
+		return float64(sessions.Active())
+	})
+
+	return s
+}
+
+//shortURL returns the full short URL for the given id
+func (s *Server) shortURL(r *http.Request, id string) string {
+	if s.PublicURL != "" {
+		return strings.TrimSuffix(s.PublicURL, "/") + "/" + id
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: "/" + id}).String()
 }
@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//unfurlRetryInterval is how long to wait before fetching metadata again after an error
+const unfurlRetryInterval = time.Hour
+
+var unfurlTemplate = template.Must(template.ParseFS(templateFS, "templates/unfurl.html"))
+
+type unfurlData struct {
+	ShortURL    string
+	URL         string
+	SiteName    string
+	Title       string
+	Description string
+	Image       string
+}
+
+//queueUnfurl queues fetching the destination metadata for the URL with the given id, if unfurling is enabled
+func (s *Server) queueUnfurl(id string) {
+	if s.Unfurl != nil {
+		s.Unfurl.Queue(id)
+	}
+}
+
+//writeUnfurl writes a page with Open Graph tags for u to unfurlers.
+//It returns false without writing anything if there's nothing to show
+func (s *Server) writeUnfurl(w http.ResponseWriter, r *http.Request, u *db.URL) bool {
+	dest, err := url.Parse(u.URL)
+	if err != nil || (dest.Scheme != "http" && dest.Scheme != "https") {
+		return false
+	}
+
+	data := &unfurlData{ShortURL: s.shortURL(r, u.ID), URL: u.URL, SiteName: s.AppTitle,
+		Title: u.UnfurlTitle, Description: u.UnfurlDescription}
+
+	//metadata is only used if it was fetched for the current destination
+	if u.Unfurl != nil && u.Unfurl.URL == u.URL {
+		if data.Title == "" {
+			data.Title = u.Unfurl.Title
+		}
+		if data.Description == "" {
+			data.Description = u.Unfurl.Description
+		}
+		data.Image = u.Unfurl.Image
+		if u.Unfurl.Error != "" && u.Unfurl.Fetched != nil && time.Since(*(u.Unfurl.Fetched)) > unfurlRetryInterval {
+			s.queueUnfurl(u.ID)
+		}
+	} else {
+		s.queueUnfurl(u.ID)
+	}
+
+	//fall back to the URL's own title and description
+	if data.Title == "" {
+		data.Title = u.Title
+	}
+	if data.Description == "" {
+		data.Description = u.Description
+	}
+
+	if data.Title == "" && data.Description == "" && data.Image == "" {
+		return false
+	}
+
+	if data.Title == "" {
+		data.Title = dest.Host
+	}
+
+	buf := new(bytes.Buffer)
+	if err := unfurlTemplate.Execute(buf, data); err != nil {
+		s.requestLogger(r).Error("Unable to render unfurl page", "id", u.ID, "error", err)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := buf.WriteTo(w); err != nil {
+		s.requestLogger(r).Debug("Unable to write unfurl page", "id", u.ID, "error", err)
+	}
+
+	return true
+}
@@ -0,0 +1,127 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//defaultDeliveriesLimit is the number of deliveries returned if no limit is given
+const defaultDeliveriesLimit = 100
+
+//notify queues a webhook event for url caused by the given user, if webhooks are enabled
+func (s *Server) notify(r *http.Request, event string, url *db.URL, user string) {
+	if s.Webhooks == nil || url == nil {
+		return
+	}
+
+	if err := s.Webhooks.Notify(event, url, user); err != nil {
+		s.requestLogger(r).Error("Unable to queue webhook event", "event", event, "id", url.ID, "error", err)
+	}
+}
+
+//checkWebhooks returns an error response if the request isn't from an admin or webhooks are disabled
+func (s *Server) checkWebhooks(r *http.Request) (int, error) {
+	session := jsonapi.GetSession(r)
+	if !s.isAdmin(session) {
+		return http.StatusForbidden, fmt.Errorf("User %s does not have permission to manage webhooks", session.Username())
+	}
+
+	if s.Webhooks == nil {
+		return http.StatusNotFound, errors.New("Webhooks are disabled")
+	}
+
+	return http.StatusOK, nil
+}
+
+func (s *Server) webhooksHandler(r *http.Request) (int, interface{}) {
+	type response struct {
+		Webhooks []*db.Webhook `json:"webhooks"`
+	}
+
+	if code, err := s.checkWebhooks(r); err != nil {
+		return code, err
+	}
+
+	hooks, err := s.Webhooks.Webhooks()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get webhooks: %v", err)
+	}
+
+	//secrets are only returned when a webhook is created
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+
+	return http.StatusOK, &response{Webhooks: hooks}
+}
+
+func (s *Server) addWebhookHandler(r *http.Request) (int, interface{}) {
+	type request struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+
+	if code, err := s.checkWebhooks(r); err != nil {
+		return code, err
+	}
+
+	req := new(request)
+	if err := jsonapi.ParseJSONBody(r, req); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	hook, err := s.Webhooks.AddWebhook(req.URL, req.Events, req.Secret, jsonapi.GetSession(r).Username())
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("Unable to add webhook: %v", err)
+	}
+
+	logActionID(r, hook.ID)
+
+	return http.StatusOK, hook
+}
+
+func (s *Server) deleteWebhookHandler(r *http.Request) (int, interface{}) {
+	if code, err := s.checkWebhooks(r); err != nil {
+		return code, err
+	}
+
+	id := mux.Vars(r)["id"]
+	if err := s.Webhooks.DeleteWebhook(id); err != nil {
+		return http.StatusNotFound, fmt.Errorf("Unable to delete webhook %s: %v", id, err)
+	}
+
+	return http.StatusOK, nil
+}
+
+func (s *Server) deliveriesHandler(r *http.Request) (int, interface{}) {
+	type response struct {
+		Deliveries []*db.Delivery `json:"deliveries"`
+	}
+
+	if code, err := s.checkWebhooks(r); err != nil {
+		return code, err
+	}
+
+	limit := defaultDeliveriesLimit
+	if v := r.FormValue("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			return http.StatusBadRequest, fmt.Errorf(`Invalid limit "%s"`, v)
+		}
+		limit = l
+	}
+
+	deliveries, err := s.Webhooks.Deliveries(limit)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get deliveries: %v", err)
+	}
+
+	return http.StatusOK, &response{Deliveries: deliveries}
+}
@@ -0,0 +1,416 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	mathrand "math/rand"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/korylprince/httputil/jsonapi"
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/rand"
+)
+
+//yourlsSignatureLength is the length of generated API signature tokens
+const yourlsSignatureLength = 20
+
+//yourlsNonceLife is the time a time-limited signature is valid for
+const yourlsNonceLife = 12 * time.Hour
+
+const yourlsTimeFormat = "2006-01-02 15:04:05"
+
+var validIDRegexp = regexp.MustCompile("^" + allowedIDRegexp + "$")
+
+func (s *Server) signatureHandler(r *http.Request) (int, interface{}) {
+	type response struct {
+		Signature string `json:"signature"`
+	}
+
+	user := jsonapi.GetSession(r).Username()
+
+	signatures, err := s.db.Signatures()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get signatures: %v", err)
+	}
+
+	signature, ok := signatures[user]
+	if !ok || r.Method == http.MethodPost {
+		signature = rand.String(yourlsSignatureLength)
+		if err = s.db.SetSignature(user, signature); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Unable to set signature for user %s: %v", user, err)
+		}
+	}
+
+	return http.StatusOK, &response{Signature: signature}
+}
+
+//yourlsField is a key and value in a YOURLS API response
+type yourlsField struct {
+	Key   string
+	Value interface{}
+}
+
+//yourlsObject is an ordered YOURLS API response object
+type yourlsObject []yourlsField
+
+//MarshalJSON implements the json.Marshaler interface
+func (o yourlsObject) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for idx, f := range o {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (o yourlsObject) encodeXML(e *xml.Encoder) error {
+	for _, f := range o {
+		start := xml.StartElement{Name: xml.Name{Local: f.Key}}
+		if obj, ok := f.Value.(yourlsObject); ok {
+			if err := e.EncodeToken(start); err != nil {
+				return err
+			}
+			if err := obj.encodeXML(e); err != nil {
+				return err
+			}
+			if err := e.EncodeToken(start.End()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := e.EncodeElement(fmt.Sprint(f.Value), start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func yourlsError(code int, message string) (int, yourlsObject, string) {
+	return code, yourlsObject{{"errorCode", code}, {"message", message}}, message
+}
+
+//yourlsUser returns the user authenticated by the request's signature or username and password,
+//or an empty string if the request isn't authenticated
+func (s *Server) yourlsUser(r *http.Request) (string, error) {
+	signature := r.FormValue("signature")
+	if signature == "" {
+		username, password := r.FormValue("username"), r.FormValue("password")
+		if username == "" || password == "" {
+			return "", nil
+		}
+
+		session, err := s.auth.Authenticate(username, password)
+		if err != nil || session == nil {
+			return "", err
+		}
+		return session.Username(), nil
+	}
+
+	signatures, err := s.db.Signatures()
+	if err != nil {
+		return "", fmt.Errorf("Unable to get signatures: %v", err)
+	}
+
+	timestamp := r.FormValue("timestamp")
+	if timestamp == "" {
+		for user, token := range signatures {
+			if subtle.ConstantTimeCompare([]byte(signature), []byte(token)) == 1 {
+				return user, nil
+			}
+		}
+		return "", nil
+	}
+
+	//time-limited signatures are hash(timestamp + token)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", nil
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > yourlsNonceLife || d < -yourlsNonceLife {
+		return "", nil
+	}
+
+	var h func() hash.Hash
+	switch r.FormValue("hash") {
+	case "", "md5":
+		h = md5.New
+	case "sha1":
+		h = sha1.New
+	default:
+		return "", nil
+	}
+
+	for user, token := range signatures {
+		sum := h()
+		sum.Write([]byte(timestamp + token))
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(signature)), []byte(hex.EncodeToString(sum.Sum(nil)))) == 1 {
+			return user, nil
+		}
+	}
+
+	return "", nil
+}
+
+//yourlsKeyword returns the keyword for a shorturl parameter which can either be a keyword or full short URL
+func yourlsKeyword(shorturl string) string {
+	if u, err := neturl.Parse(shorturl); err == nil && u.Host != "" {
+		return path.Base(u.Path)
+	}
+	return shorturl
+}
+
+//yourlsTitle returns the title of url, or its destination if it doesn't have one
+func yourlsTitle(url *db.URL) string {
+	if url.Title != "" {
+		return url.Title
+	}
+	return url.URL
+}
+
+func (s *Server) yourlsLink(r *http.Request, url *db.URL) yourlsObject {
+	return yourlsObject{
+		{"shorturl", s.shortURL(r, url.ID)},
+		{"url", url.URL},
+		{"title", yourlsTitle(url)},
+		{"timestamp", url.Created.Format(yourlsTimeFormat)},
+		{"ip", ""},
+		{"clicks", strconv.FormatUint(url.Views, 10)},
+	}
+}
+
+func (s *Server) yourlsShortURL(r *http.Request, user string) (int, yourlsObject, string) {
+	longURL := r.FormValue("url")
+	if _, err := neturl.ParseRequestURI(longURL); err != nil {
+		return yourlsError(http.StatusBadRequest, "Missing or malformed URL")
+	}
+
+	keyword := r.FormValue("keyword")
+	if keyword != "" && !validIDRegexp.MatchString(keyword) {
+		return yourlsError(http.StatusBadRequest, fmt.Sprintf("Keyword %s is not valid", keyword))
+	}
+
+	url := &db.URL{ID: keyword, URL: longURL, Title: r.FormValue("title")}
+	if err := db.NormalizeURL(url); err != nil {
+		return yourlsError(http.StatusBadRequest, err.Error())
+	}
+
+	//reserved keywords are reported the same way as existing ones
+	id, err := "", fmt.Errorf("URL %s already exists", keyword)
+	if !db.ReservedID(s.normalizeID(keyword)) {
+		id, err = s.db.Put(url, user)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			message := fmt.Sprintf("Short URL %s already exists in database or is reserved", keyword)
+			return http.StatusOK, yourlsObject{
+				{"status", "fail"},
+				{"code", "error:keyword"},
+				{"message", message},
+				{"errorCode", http.StatusBadRequest},
+				{"statusCode", http.StatusOK},
+			}, message
+		}
+		s.requestLogger(r).Error("YOURLS API: Unable to put URL", "url", longURL, "error", err)
+		return yourlsError(http.StatusInternalServerError, "Error saving URL to database")
+	}
+
+	url, err = s.db.Get(id)
+	if err != nil || url == nil {
+		s.requestLogger(r).Error("YOURLS API: Unable to get URL", "id", id, "error", err)
+		return yourlsError(http.StatusInternalServerError, "Error reading URL from database")
+	}
+
+	s.notify(r, db.EventCreated, url, user)
+	s.queueUnfurl(id)
+
+	short := s.shortURL(r, id)
+	return http.StatusOK, yourlsObject{
+		{"url", yourlsObject{
+			{"keyword", id},
+			{"url", url.URL},
+			{"title", yourlsTitle(url)},
+			{"date", url.Created.Format(yourlsTimeFormat)},
+			{"ip", ""},
+		}},
+		{"status", "success"},
+		{"message", fmt.Sprintf("%s added to database", url.URL)},
+		{"title", yourlsTitle(url)},
+		{"shorturl", short},
+		{"statusCode", http.StatusOK},
+	}, short
+}
+
+func (s *Server) yourlsExpand(r *http.Request, user string) (int, yourlsObject, string) {
+	keyword := yourlsKeyword(r.FormValue("shorturl"))
+
+	url, err := s.db.Get(keyword)
+	if err != nil {
+		s.requestLogger(r).Error("YOURLS API: Unable to get URL", "id", keyword, "error", err)
+		return yourlsError(http.StatusInternalServerError, "Error reading URL from database")
+	}
+	if url == nil {
+		return yourlsError(http.StatusNotFound, "Error: short URL not found")
+	}
+
+	if r.FormValue("action") == "expand" {
+		return http.StatusOK, yourlsObject{
+			{"keyword", url.ID},
+			{"shorturl", s.shortURL(r, url.ID)},
+			{"longurl", url.URL},
+			{"title", yourlsTitle(url)},
+			{"message", "success"},
+			{"statusCode", http.StatusOK},
+		}, url.URL
+	}
+
+	if url.User != user {
+		return yourlsError(http.StatusForbidden, "Error: short URL not owned by user")
+	}
+
+	return http.StatusOK, yourlsObject{
+		{"statusCode", http.StatusOK},
+		{"message", "success"},
+		{"link", s.yourlsLink(r, url)},
+	}, url.URL
+}
+
+func (s *Server) yourlsStats(r *http.Request, user string) (int, yourlsObject, string) {
+	urls, err := s.db.URLs(user)
+	if err != nil {
+		s.requestLogger(r).Error("YOURLS API: Unable to get URLs", "error", err)
+		return yourlsError(http.StatusInternalServerError, "Error reading URLs from database")
+	}
+
+	var clicks uint64
+	for _, url := range urls {
+		clicks += url.Views
+	}
+
+	stats := yourlsObject{
+		{"total_links", strconv.Itoa(len(urls))},
+		{"total_clicks", strconv.FormatUint(clicks, 10)},
+	}
+
+	if r.FormValue("action") == "db-stats" {
+		return http.StatusOK, yourlsObject{{"db-stats", stats}, {"statusCode", http.StatusOK}, {"message", "success"}}, "success"
+	}
+
+	switch r.FormValue("filter") {
+	case "bottom":
+		sort.SliceStable(urls, func(i, j int) bool { return urls[i].Views < urls[j].Views })
+	case "rand":
+		mathrand.Shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	case "last":
+		sort.SliceStable(urls, func(i, j int) bool { return urls[i].Created.After(*(urls[j].Created)) })
+	default:
+		sort.SliceStable(urls, func(i, j int) bool { return urls[i].Views > urls[j].Views })
+	}
+
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit < len(urls) {
+		urls = urls[:limit]
+	}
+
+	links := make(yourlsObject, 0, len(urls))
+	for idx, url := range urls {
+		links = append(links, yourlsField{fmt.Sprintf("link_%d", idx+1), s.yourlsLink(r, url)})
+	}
+
+	return http.StatusOK, yourlsObject{
+		{"links", links},
+		{"stats", stats},
+		{"statusCode", http.StatusOK},
+		{"message", "success"},
+	}, "success"
+}
+
+//yourlsHandler implements the YOURLS yourls-api.php API
+func (s *Server) yourlsHandler(w http.ResponseWriter, r *http.Request) {
+	code, body, simple := func() (int, yourlsObject, string) {
+		user, err := s.yourlsUser(r)
+		if err != nil {
+			s.requestLogger(r).Error("YOURLS API: Unable to authenticate", "error", err)
+			return yourlsError(http.StatusInternalServerError, "Unable to authenticate")
+		}
+		if user == "" {
+			return yourlsError(http.StatusForbidden, "Please log in")
+		}
+		logUser(r, user)
+
+		switch r.FormValue("action") {
+		case "shorturl":
+			return s.yourlsShortURL(r, user)
+		case "expand", "url-stats":
+			return s.yourlsExpand(r, user)
+		case "stats", "db-stats":
+			return s.yourlsStats(r, user)
+		default:
+			return yourlsError(http.StatusBadRequest, "Unknown or missing action parameter")
+		}
+	}()
+
+	switch r.FormValue("format") {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			s.requestLogger(r).Error("YOURLS API: Unable to write JSON response", "error", err)
+		}
+	case "simple":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		fmt.Fprint(w, simple)
+	default:
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(code)
+		e := xml.NewEncoder(w)
+		start := xml.StartElement{Name: xml.Name{Local: "result"}}
+		err := e.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)})
+		if err == nil {
+			err = e.EncodeToken(start)
+		}
+		if err == nil {
+			err = body.encodeXML(e)
+		}
+		if err == nil {
+			err = e.EncodeToken(start.End())
+		}
+		if err == nil {
+			err = e.Flush()
+		}
+		if err != nil {
+			s.requestLogger(r).Error("YOURLS API: Unable to write XML response", "error", err)
+		}
+	}
+}
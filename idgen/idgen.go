@@ -0,0 +1,110 @@
+//Package idgen generates IDs for new URLs
+package idgen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/korylprince/url-shortener-server/v2/rand"
+)
+
+//Alphabets for random IDs
+const (
+	//Unambiguous leaves out characters that are easily confused: 0, O, o, 1, l, and I
+	Unambiguous = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	//Lowercase is easy to read aloud, and leaves out l, o, 0, and 1
+	Lowercase = "abcdefghijkmnpqrstuvwxyz23456789"
+	//Base62 is the alphabet for sequential IDs
+	Base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+//Strategies are the names accepted by New
+var Strategies = []string{"random", "unambiguous", "lowercase", "words", "sequential"}
+
+//Generator generates candidate IDs. Candidates may already be in use
+type Generator interface {
+	//Generate returns a candidate ID. grow is the number of times IDs have been made longer after repeated collisions,
+	//and seq is the next value of a database sequence if Sequential returns true
+	Generate(grow int, seq uint64) string
+
+	//Sequential returns true if the generator uses a database sequence
+	Sequential() bool
+}
+
+//New returns a new Generator for the given strategy (one of Strategies) and ID length,
+//or an error if the strategy is unknown or the length isn't positive. The words strategy ignores length
+func New(strategy string, length int) (Generator, error) {
+	if length < 1 {
+		return nil, fmt.Errorf("Invalid ID length: %d", length)
+	}
+
+	switch strings.ToLower(strategy) {
+	case "", "random":
+		return &alphabet{chars: rand.Characters, length: length}, nil
+	case "unambiguous":
+		return &alphabet{chars: Unambiguous, length: length}, nil
+	case "lowercase":
+		return &alphabet{chars: Lowercase, length: length}, nil
+	case "words":
+		return words{}, nil
+	case "sequential":
+		return &sequence{length: length}, nil
+	default:
+		return nil, fmt.Errorf("Unknown ID strategy: %s", strategy)
+	}
+}
+
+//alphabet generates random IDs from chars, one character longer for each grow
+type alphabet struct {
+	chars  string
+	length int
+}
+
+func (a *alphabet) Generate(grow int, seq uint64) string {
+	return rand.StringFrom(a.chars, a.length+grow)
+}
+
+func (a *alphabet) Sequential() bool {
+	return false
+}
+
+//words generates adjective-noun pairs like brave-otter, with another adjective for each grow
+type words struct{}
+
+func (words) Generate(grow int, seq uint64) string {
+	parts := make([]string, 0, grow+2)
+	for i := 0; i <= grow; i++ {
+		parts = append(parts, adjectives[rand.Intn(len(adjectives))])
+	}
+	parts = append(parts, nouns[rand.Intn(len(nouns))])
+	return strings.Join(parts, "-")
+}
+
+func (words) Sequential() bool {
+	return false
+}
+
+//sequence generates base62 encodings of the sequence, padded to length with zeros. IDs grow as the sequence does
+type sequence struct {
+	length int
+}
+
+func (s *sequence) Generate(grow int, seq uint64) string {
+	var id []byte
+	for ; seq > 0; seq /= 62 {
+		id = append(id, Base62[seq%62])
+	}
+	for len(id) < s.length {
+		id = append(id, Base62[0])
+	}
+
+	for i, j := 0, len(id)-1; i < j; i, j = i+1, j-1 {
+		id[i], id[j] = id[j], id[i]
+	}
+
+	return string(id)
+}
+
+func (s *sequence) Sequential() bool {
+	return true
+}
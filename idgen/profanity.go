@@ -0,0 +1,30 @@
+package idgen
+
+import "strings"
+
+//blocked are substrings that generated IDs may not contain, after lowercasing and undoing common digit substitutions
+var blocked = []string{
+	"anal", "anus", "arse", "ass", "bitch", "boob", "butt", "cock", "coon", "crap",
+	"cum", "cunt", "damn", "dick", "dildo", "dyke", "fag", "fuck", "fuk", "gay",
+	"hell", "homo", "jizz", "kike", "kkk", "milf", "nazi", "negro", "nigg", "nig",
+	"paki", "penis", "piss", "poop", "porn", "pube", "puss", "rape", "retard", "scum",
+	"sex", "shit", "slut", "spic", "suck", "tit", "twat", "vagina", "wank", "whore",
+	"wtf", "xxx",
+}
+
+//leet maps digits commonly substituted for letters
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g")
+
+//Clean returns false if id contains a blocked word, including when spelled with digits or mixed case
+func Clean(id string) bool {
+	lower := strings.ToLower(id)
+	for _, s := range []string{lower, leet.Replace(lower), strings.ReplaceAll(leet.Replace(lower), "i", "l")} {
+		for _, word := range blocked {
+			if strings.Contains(s, word) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,30 @@
+package idgen
+
+import (
+	"fmt"
+
+	"github.com/korylprince/url-shortener-server/v2/rand"
+)
+
+//maxVariations is the number of each kind of variation returned by Variations
+const maxVariations = 8
+
+//Variations returns alternatives to id for when it's taken, alternating between id with a number added
+//(id-2, id-3, ...) and id with a random adjective added (brave-id, ...)
+func Variations(id string) []string {
+	//pick adjectives without repeats
+	picked := make(map[int]bool, maxVariations)
+	variations := make([]string, 0, 2*maxVariations)
+	for i := 0; i < maxVariations; i++ {
+		variations = append(variations, fmt.Sprintf("%s-%d", id, i+2))
+
+		n := rand.Intn(len(adjectives))
+		for picked[n] {
+			n = rand.Intn(len(adjectives))
+		}
+		picked[n] = true
+		variations = append(variations, adjectives[n]+"-"+id)
+	}
+
+	return variations
+}
@@ -0,0 +1,40 @@
+package idgen
+
+//adjectives and nouns are combined by the words strategy. Words are short, common, and easy to spell
+var adjectives = []string{
+	"able", "agile", "amber", "ample", "azure", "baked", "bold", "brave",
+	"breezy", "bright", "brisk", "bubbly", "busy", "calm", "candid", "cheery",
+	"chief", "chilly", "civic", "clean", "clear", "clever", "cloudy", "cool",
+	"cosmic", "cozy", "crisp", "curly", "cyan", "daily", "dandy", "daring",
+	"dapper", "dewy", "eager", "early", "easy", "elated", "even", "exact",
+	"fair", "fancy", "fast", "fine", "fluffy", "fond", "fresh", "frosty",
+	"funny", "gentle", "giant", "glad", "golden", "grand", "green", "happy",
+	"hardy", "hearty", "honest", "humble", "icy", "ideal", "jolly", "jumpy",
+	"keen", "kind", "large", "lively", "loyal", "lucky", "lunar", "magic",
+	"mellow", "merry", "mighty", "misty", "modern", "noble", "nimble", "novel",
+	"oaken", "olive", "open", "plain", "plucky", "polite", "proud", "quick",
+	"quiet", "rapid", "ready", "regal", "rosy", "royal", "rustic", "sandy",
+	"shiny", "silent", "silver", "simple", "sleek", "smart", "snowy", "solar",
+	"solid", "sporty", "steady", "stormy", "sturdy", "sunny", "super", "sweet",
+	"swift", "tidy", "tiny", "topaz", "tough", "trusty", "upbeat", "urban",
+	"vast", "vivid", "warm", "wavy", "wise", "witty", "young", "zesty",
+}
+
+var nouns = []string{
+	"acorn", "anchor", "apple", "arrow", "badger", "bagel", "beacon", "beaver",
+	"berry", "bison", "breeze", "brook", "cactus", "camel", "candle", "canyon",
+	"castle", "cedar", "cherry", "cloud", "comet", "coral", "cotton", "crane",
+	"cricket", "daisy", "delta", "dolphin", "dragon", "eagle", "ember", "falcon",
+	"fern", "finch", "forest", "fox", "galaxy", "garden", "gecko", "glacier",
+	"harbor", "hawk", "hazel", "heron", "hill", "island", "jaguar", "jasper",
+	"kayak", "kettle", "kiwi", "koala", "lagoon", "lantern", "lemon", "lily",
+	"lion", "lotus", "maple", "meadow", "melon", "meteor", "mango", "moose",
+	"nebula", "needle", "oak", "ocean", "orbit", "orchid", "otter", "owl",
+	"panda", "pebble", "pepper", "pine", "planet", "plum", "pony", "prairie",
+	"quail", "quartz", "rabbit", "raven", "reef", "river", "robin", "rocket",
+	"saddle", "salmon", "sparrow", "spruce", "squid", "star", "stone", "summit",
+	"swan", "thistle", "tiger", "timber", "tulip", "tundra", "turtle", "valley",
+	"violet", "walrus", "willow", "wombat", "yak", "zebra", "acre", "aspen",
+	"basil", "birch", "bramble", "cobble", "dune", "fjord", "grove", "heath",
+	"iris", "juniper", "lark", "marsh", "nectar", "puffin", "sage", "tide",
+}
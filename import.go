@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/korylprince/url-shortener-server/v2/importer"
+)
+
+func importCommand(config *Config, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "export format: "+strings.Join(importer.Formats, ", "))
+	ownersPath := flags.String("owners", "", `owners mapping CSV file of "id or source owner,username" lines; use "*" as the default`)
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without writing to the database")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import -format <format> [-owners <file>] [-dry-run] <file>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatalln("Unable to open import file:", err)
+	}
+	defer f.Close()
+
+	records, err := importer.Parse(*format, f)
+	if err != nil {
+		log.Fatalln("Unable to parse import file:", err)
+	}
+
+	opts := &importer.Options{Owners: map[string]string{}, DryRun: *dryRun, CaseInsensitiveIDs: config.CaseInsensitiveIDs}
+	if *ownersPath != "" {
+		of, err := os.Open(*ownersPath)
+		if err != nil {
+			log.Fatalln("Unable to open owners file:", err)
+		}
+		opts.Owners, err = importer.ReadOwners(of)
+		of.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	db := openDB(config)
+	defer db.Close()
+
+	report, err := importer.Import(db, records, opts)
+	if err != nil {
+		log.Fatalln("Unable to import URLs:", err)
+	}
+
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err = e.Encode(report); err != nil {
+		log.Fatalln("Unable to write report:", err)
+	}
+}
@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//bitlyColumns maps normalized Bitly CSV header names to fields
+var bitlyColumns = map[string]string{
+	"bitlink":     "id",
+	"link":        "id",
+	"shorturl":    "id",
+	"customlink":  "id",
+	"longurl":     "url",
+	"destination": "url",
+	"created":     "created",
+	"createdat":   "created",
+	"datecreated": "created",
+	"clicks":      "clicks",
+	"totalclicks": "clicks",
+	"createdby":   "owner",
+	"owner":       "owner",
+	"user":        "owner",
+}
+
+func normalizeHeader(h string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(h)))
+}
+
+func parseBitly(r io.Reader) ([]*Record, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+
+	rows, err := c.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read CSV: %v", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("CSV is empty")
+	}
+
+	fields := make(map[string]int)
+	for idx, col := range rows[0] {
+		if field, ok := bitlyColumns[normalizeHeader(col)]; ok {
+			if _, ok = fields[field]; !ok {
+				fields[field] = idx
+			}
+		}
+	}
+
+	if _, ok := fields["id"]; !ok {
+		return nil, errors.New("CSV header missing bitlink column")
+	}
+	if _, ok := fields["url"]; !ok {
+		return nil, errors.New("CSV header missing long URL column")
+	}
+
+	records := make([]*Record, 0, len(rows)-1)
+	for idx, row := range rows[1:] {
+		get := func(field string) string {
+			if i, ok := fields[field]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		rec := &Record{
+			URL: &db.URL{
+				//bitlinks are of the form bit.ly/id
+				ID:      path.Base(strings.TrimRight(get("id"), "/")),
+				URL:     get("url"),
+				Created: parseTime(get("created")),
+			},
+			Owner: get("owner"),
+		}
+
+		if clicks := strings.ReplaceAll(get("clicks"), ",", ""); clicks != "" {
+			views, err := strconv.ParseUint(clicks, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf(`Unable to parse row %d clicks "%s": %v`, idx+2, clicks, err)
+			}
+			rec.URL.Views = views
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,239 @@
+//Package importer imports URLs from other URL shortener export formats
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//Supported import formats
+const (
+	FormatJSON      = "json"
+	FormatYOURLSSQL = "yourls-sql"
+	FormatYOURLSCSV = "yourls-csv"
+	FormatBitly     = "bitly"
+	FormatShlink    = "shlink"
+)
+
+//Formats is the list of supported import formats
+var Formats = []string{FormatJSON, FormatYOURLSSQL, FormatYOURLSCSV, FormatBitly, FormatShlink}
+
+//DefaultOwner is the owners mapping key used when no other key matches
+const DefaultOwner = "*"
+
+var validID = regexp.MustCompile("^" + db.IDRegexp + "$")
+
+//Record is a URL read from an export, along with the owner identifier from the source system, if any
+type Record struct {
+	URL   *db.URL
+	Owner string
+}
+
+//Parse parses the export in the given format from r and returns the records, or an error if one occurred
+func Parse(format string, r io.Reader) ([]*Record, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON(r)
+	case FormatYOURLSSQL:
+		return parseYOURLSSQL(r)
+	case FormatYOURLSCSV:
+		return parseYOURLSCSV(r)
+	case FormatBitly:
+		return parseBitly(r)
+	case FormatShlink:
+		return parseShlink(r)
+	default:
+		return nil, fmt.Errorf("Unknown format %s: must be one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+//ReadOwners reads an owners mapping file from r. Each line is a CSV record of the form "key,username",
+//where key is a URL ID or owner identifier from the source system, or DefaultOwner.
+//Records that already have a user (e.g. the JSON format) keep it unless their ID or owner is mapped
+func ReadOwners(r io.Reader) (map[string]string, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = 2
+	c.Comment = '#'
+	c.TrimLeadingSpace = true
+
+	owners := make(map[string]string)
+	for {
+		rec, err := c.Read()
+		if err == io.EOF {
+			return owners, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read owners mapping: %v", err)
+		}
+		owners[strings.TrimSpace(rec[0])] = strings.TrimSpace(rec[1])
+	}
+}
+
+//Options configures an import
+type Options struct {
+	//Owners maps URL IDs or source owner identifiers to usernames. See ReadOwners
+	Owners map[string]string
+	//DryRun reports what would be imported without writing to the database
+	DryRun bool
+	//CaseInsensitiveIDs lowercases IDs like the database does, so reserved and duplicate IDs are found in any case
+	CaseInsensitiveIDs bool
+}
+
+//Problem is a record that was not imported
+type Problem struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+//Report is the result of an import
+type Report struct {
+	DryRun     bool       `json:"dry_run"`
+	Total      int        `json:"total"`
+	Imported   int        `json:"imported"`
+	Collisions []*Problem `json:"collisions"`
+	Invalid    []*Problem `json:"invalid"`
+}
+
+func (o *Options) owner(rec *Record) string {
+	if owner, ok := o.Owners[rec.URL.ID]; ok {
+		return owner
+	}
+	if owner, ok := o.Owners[rec.Owner]; ok && rec.Owner != "" {
+		return owner
+	}
+	if rec.URL.User != "" {
+		return rec.URL.User
+	}
+	return o.Owners[DefaultOwner]
+}
+
+//Export writes all URLs in d to w in the JSON import format or returns an error if one occurred
+func Export(d db.DB, w io.Writer) error {
+	urls, err := d.URLs("")
+	if err != nil {
+		return fmt.Errorf("Unable to get URLs: %v", err)
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	if err = e.Encode(urls); err != nil {
+		return fmt.Errorf("Unable to encode URLs: %v", err)
+	}
+
+	return nil
+}
+
+func parseJSON(r io.Reader) ([]*Record, error) {
+	var urls []*db.URL
+	if err := json.NewDecoder(r).Decode(&urls); err != nil {
+		return nil, fmt.Errorf("Unable to parse JSON: %v", err)
+	}
+
+	records := make([]*Record, 0, len(urls))
+	for _, url := range urls {
+		records = append(records, &Record{URL: url, Owner: url.User})
+	}
+
+	return records, nil
+}
+
+//Import imports the given records into d and returns a report, or an error if one occurred.
+//Records that collide with existing URLs or each other are never overwritten, and records the database refuses
+//are reported instead of stopping the import
+func Import(d db.DB, records []*Record, opts *Options) (*Report, error) {
+	report := &Report{DryRun: opts.DryRun, Total: len(records), Collisions: make([]*Problem, 0), Invalid: make([]*Problem, 0)}
+	seen := make(map[string]bool)
+
+	for _, rec := range records {
+		url := rec.URL
+		invalid := func(reason string) {
+			report.Invalid = append(report.Invalid, &Problem{ID: url.ID, URL: url.URL, Reason: reason})
+		}
+
+		if !validID.MatchString(url.ID) {
+			invalid("invalid ID")
+			continue
+		}
+
+		id := url.ID
+		if opts.CaseInsensitiveIDs {
+			id = strings.ToLower(id)
+		}
+
+		if db.ReservedID(id) {
+			invalid("reserved ID")
+			continue
+		}
+
+		if _, err := neturl.ParseRequestURI(url.URL); err != nil {
+			invalid(fmt.Sprintf("invalid URL: %v", err))
+			continue
+		}
+
+		if url.User = opts.owner(rec); url.User == "" {
+			invalid("no owner mapping")
+			continue
+		}
+		url.ID = id
+
+		if seen[id] {
+			report.Collisions = append(report.Collisions, &Problem{ID: url.ID, URL: url.URL, Reason: "duplicate ID in import"})
+			continue
+		}
+		seen[id] = true
+
+		existing, err := d.Get(url.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get URL %s: %v", url.ID, err)
+		}
+		if existing != nil {
+			report.Collisions = append(report.Collisions, &Problem{ID: url.ID, URL: url.URL, Reason: fmt.Sprintf("ID already exists for %s", existing.URL)})
+			continue
+		}
+
+		if !opts.DryRun {
+			if err = d.Import(url); err != nil {
+				if strings.Contains(err.Error(), "already exists") {
+					report.Collisions = append(report.Collisions, &Problem{ID: url.ID, URL: url.URL, Reason: err.Error()})
+				} else {
+					invalid(err.Error())
+				}
+				continue
+			}
+		}
+		report.Imported++
+	}
+
+	return report, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 -0700 MST",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"1/2/2006 15:04",
+	"1/2/2006",
+}
+
+func parseTime(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
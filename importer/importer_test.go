@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+)
+
+//failingDB is a db.DB that refuses to import the URL with the given id
+type failingDB struct {
+	db.DB
+	id string
+}
+
+func (d *failingDB) Import(url *db.URL) error {
+	if url.ID == d.id {
+		return errors.New("Unable to put URL: disk full")
+	}
+	return d.DB.Import(url)
+}
+
+func TestImportDryRunMatches(t *testing.T) {
+	records := func() []*Record {
+		return []*Record{
+			{URL: &db.URL{ID: "Foo", URL: "https://example.com/a", User: "alice"}},
+			{URL: &db.URL{ID: "foo", URL: "https://example.com/b", User: "alice"}},
+			{URL: &db.URL{ID: "Existing", URL: "https://example.com/c", User: "alice"}},
+			{URL: &db.URL{ID: "broken", URL: "https://example.com/d", User: "alice"}},
+			{URL: &db.URL{ID: "bar", URL: "https://example.com/e", User: "alice"}},
+			{URL: &db.URL{ID: "bad id", URL: "https://example.com/f", User: "alice"}},
+			{URL: &db.URL{ID: "API", URL: "https://example.com/g", User: "alice"}},
+		}
+	}
+
+	var reports []*Report
+	for _, dryRun := range []bool{true, false} {
+		b, err := bbolt.New(filepath.Join(t.TempDir(), "urls.db"), 6)
+		if err != nil {
+			t.Fatalf("Unable to create database: %v", err)
+		}
+		defer b.Close()
+		b.CaseInsensitiveIDs()
+		if _, err = b.Put(&db.URL{ID: "existing", URL: "https://example.com/old"}, "bob"); err != nil {
+			t.Fatal(err)
+		}
+
+		//only the real run can find out the database refuses a record
+		d := db.DB(b)
+		if !dryRun {
+			d = &failingDB{DB: b, id: "broken"}
+		}
+
+		report, err := Import(d, records(), &Options{DryRun: dryRun, CaseInsensitiveIDs: true})
+		if err != nil {
+			t.Fatalf("dry run %t: unable to import: %v", dryRun, err)
+		}
+		reports = append(reports, report)
+
+		url, err := b.Get("bar")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (url != nil) == dryRun {
+			t.Errorf("dry run %t: expected record after the failed one imported %t, got %v", dryRun, !dryRun, url)
+		}
+	}
+
+	dry, real := reports[0], reports[1]
+	if dry.Total != 7 || len(dry.Collisions) != 2 || len(dry.Invalid) != 2 || dry.Imported != 3 {
+		t.Errorf("Expected dry run to import 3 with 2 collisions and 2 invalid, got %d, %v, %v", dry.Imported, dry.Collisions, dry.Invalid)
+	}
+	if real.Imported != dry.Imported-1 || len(real.Collisions) != len(dry.Collisions) || len(real.Invalid) != len(dry.Invalid)+1 {
+		t.Fatalf("Expected real run to match the dry run except the refused record, got %d, %v, %v", real.Imported, real.Collisions, real.Invalid)
+	}
+	for i, c := range dry.Collisions {
+		if c.ID != real.Collisions[i].ID {
+			t.Errorf("Expected collision %d to be %s in both runs, got %s", i, c.ID, real.Collisions[i].ID)
+		}
+	}
+	if p := real.Invalid[0]; p.ID != "broken" {
+		t.Errorf("Expected refused record to be reported as invalid, got %s: %s", p.ID, p.Reason)
+	}
+	if p := dry.Invalid[1]; p.ID != "API" || p.Reason != "reserved ID" {
+		t.Errorf("Expected reserved ID in another case to be invalid, got %s: %s", p.ID, p.Reason)
+	}
+}
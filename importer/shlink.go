@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+type shlinkURL struct {
+	ShortCode     string  `json:"shortCode"`
+	LongURL       string  `json:"longUrl"`
+	DateCreated   string  `json:"dateCreated"`
+	VisitsCount   *uint64 `json:"visitsCount"`
+	VisitsSummary *struct {
+		Total uint64 `json:"total"`
+	} `json:"visitsSummary"`
+	Meta struct {
+		ValidUntil string `json:"validUntil"`
+	} `json:"meta"`
+	AuthorAPIKey string `json:"authorApiKey"`
+}
+
+func parseShlink(r io.Reader) ([]*Record, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read JSON: %v", err)
+	}
+
+	var urls []*shlinkURL
+
+	//accept either a bare list or the Shlink REST API list response
+	if buf = bytes.TrimSpace(buf); len(buf) > 0 && buf[0] == '[' {
+		if err = json.Unmarshal(buf, &urls); err != nil {
+			return nil, fmt.Errorf("Unable to parse JSON: %v", err)
+		}
+	} else {
+		var resp struct {
+			ShortURLs struct {
+				Data []*shlinkURL `json:"data"`
+			} `json:"shortUrls"`
+		}
+		if err = json.Unmarshal(buf, &resp); err != nil {
+			return nil, fmt.Errorf("Unable to parse JSON: %v", err)
+		}
+		urls = resp.ShortURLs.Data
+	}
+
+	if len(urls) == 0 {
+		return nil, errors.New("No short URLs found")
+	}
+
+	records := make([]*Record, 0, len(urls))
+	for _, u := range urls {
+		rec := &Record{
+			URL: &db.URL{
+				ID:      u.ShortCode,
+				URL:     u.LongURL,
+				Created: parseTime(u.DateCreated),
+				Expires: parseTime(u.Meta.ValidUntil),
+			},
+			Owner: u.AuthorAPIKey,
+		}
+
+		if u.VisitsSummary != nil {
+			rec.URL.Views = u.VisitsSummary.Total
+		} else if u.VisitsCount != nil {
+			rec.URL.Views = *u.VisitsCount
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
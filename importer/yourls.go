@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//yourlsColumns is the column order of the YOURLS url table
+var yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+var yourlsInsertRegexp = regexp.MustCompile("(?i)INSERT\\s+INTO\\s+`?(\\w*url)`?\\s*(\\(([^)]*)\\))?\\s*VALUES\\s*")
+
+func yourlsRecord(columns, values []string) (*Record, error) {
+	if len(columns) != len(values) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(columns), len(values))
+	}
+
+	rec := &Record{URL: new(db.URL)}
+	for idx, col := range columns {
+		v := values[idx]
+		switch col {
+		case "keyword":
+			rec.URL.ID = v
+		case "url":
+			rec.URL.URL = v
+		case "timestamp":
+			rec.URL.Created = parseTime(v)
+		case "clicks":
+			views, err := strconv.ParseUint(v, 10, 64)
+			if err != nil && v != "" {
+				return nil, fmt.Errorf(`Unable to parse clicks "%s": %v`, v, err)
+			}
+			rec.URL.Views = views
+		case "user", "owner":
+			rec.Owner = v
+		}
+	}
+
+	return rec, nil
+}
+
+//parseSQLTuples parses SQL value tuples starting at s, e.g. ('a','b',1),('c','d',2);
+//and returns the tuples and the remaining input
+func parseSQLTuples(s string) ([][]string, string, error) {
+	var tuples [][]string
+	i := 0
+
+	skipSpace := func() {
+		for i < len(s) && strings.ContainsRune(" \t\r\n", rune(s[i])) {
+			i++
+		}
+	}
+
+	for {
+		skipSpace()
+		if i >= len(s) || s[i] != '(' {
+			return nil, "", errors.New("expected (")
+		}
+		i++
+
+		var tuple []string
+		for {
+			skipSpace()
+			if i >= len(s) {
+				return nil, "", errors.New("unexpected end of input")
+			}
+
+			if s[i] == '\'' {
+				var b strings.Builder
+				i++
+			quoted:
+				for {
+					if i >= len(s) {
+						return nil, "", errors.New("unterminated string")
+					}
+					switch c := s[i]; {
+					case c == '\\' && i+1 < len(s):
+						i++
+						switch s[i] {
+						case 'n':
+							b.WriteByte('\n')
+						case 'r':
+							b.WriteByte('\r')
+						case 't':
+							b.WriteByte('\t')
+						case '0':
+							b.WriteByte(0)
+						default:
+							b.WriteByte(s[i])
+						}
+					case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+						b.WriteByte('\'')
+						i++
+					case c == '\'':
+						i++
+						break quoted
+					default:
+						b.WriteByte(c)
+					}
+					i++
+				}
+				tuple = append(tuple, b.String())
+			} else {
+				start := i
+				for i < len(s) && s[i] != ',' && s[i] != ')' {
+					i++
+				}
+				v := strings.TrimSpace(s[start:i])
+				if strings.EqualFold(v, "NULL") {
+					v = ""
+				}
+				tuple = append(tuple, v)
+			}
+
+			skipSpace()
+			if i >= len(s) {
+				return nil, "", errors.New("unexpected end of input")
+			}
+			if s[i] == ')' {
+				i++
+				break
+			}
+			if s[i] != ',' {
+				return nil, "", fmt.Errorf("unexpected character %q", s[i])
+			}
+			i++
+		}
+		tuples = append(tuples, tuple)
+
+		skipSpace()
+		if i < len(s) && s[i] == ',' {
+			i++
+			continue
+		}
+		return tuples, s[i:], nil
+	}
+}
+
+func parseYOURLSSQL(r io.Reader) ([]*Record, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read SQL dump: %v", err)
+	}
+
+	var records []*Record
+	s := string(buf)
+	for {
+		loc := yourlsInsertRegexp.FindStringSubmatchIndex(s)
+		if loc == nil {
+			break
+		}
+
+		columns := yourlsColumns
+		if loc[6] != -1 {
+			columns = nil
+			for _, col := range strings.Split(s[loc[6]:loc[7]], ",") {
+				columns = append(columns, strings.ToLower(strings.Trim(strings.TrimSpace(col), "`")))
+			}
+		}
+
+		tuples, rest, err := parseSQLTuples(s[loc[1]:])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse INSERT INTO %s: %v", s[loc[2]:loc[3]], err)
+		}
+
+		for _, tuple := range tuples {
+			rec, err := yourlsRecord(columns, tuple)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse INSERT INTO %s: %v", s[loc[2]:loc[3]], err)
+			}
+			records = append(records, rec)
+		}
+
+		s = rest
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("No YOURLS url table INSERT statements found")
+	}
+
+	return records, nil
+}
+
+func parseYOURLSCSV(r io.Reader) ([]*Record, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+
+	rows, err := c.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read CSV: %v", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("CSV is empty")
+	}
+
+	columns := yourlsColumns
+	for _, col := range rows[0] {
+		if strings.EqualFold(strings.TrimSpace(col), "keyword") {
+			columns = nil
+			for _, col := range rows[0] {
+				columns = append(columns, strings.ToLower(strings.TrimSpace(col)))
+			}
+			rows = rows[1:]
+			break
+		}
+	}
+
+	records := make([]*Record, 0, len(rows))
+	for idx, row := range rows {
+		if len(row) < len(columns) {
+			row = append(row, make([]string, len(columns)-len(row))...)
+		}
+		rec, err := yourlsRecord(columns, row[:len(columns)])
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse row %d: %v", idx+1, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
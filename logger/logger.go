@@ -0,0 +1,236 @@
+//Package logger implements a leveled, structured logger that writes JSON or key=value text lines
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Level is a log level
+type Level int
+
+//Log levels
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+//ParseLevel returns the Level for the given name or an error if it isn't valid
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return l, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return LevelWarn, nil
+	}
+	return 0, fmt.Errorf("invalid log level %s", name)
+}
+
+//Format is a log line format
+type Format int
+
+//Log formats
+const (
+	FormatJSON Format = iota
+	FormatText
+)
+
+//ParseFormat returns the Format for the given name or an error if it isn't valid
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return FormatJSON, nil
+	case "text":
+		return FormatText, nil
+	}
+	return 0, fmt.Errorf("invalid log format %s", name)
+}
+
+//output is the destination shared by a Logger and the Loggers derived from it
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	level  Level
+	format Format
+}
+
+//Logger writes structured log lines. A Logger is safe for concurrent use
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+//New returns a new *Logger that writes lines at or above level to w in the given format
+func New(w io.Writer, level Level, format Format) *Logger {
+	return &Logger{out: &output{w: w, level: level, format: format}}
+}
+
+//With returns a new *Logger that adds the given key value pairs to every line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(append(fields, l.fields...), kv...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+//Enabled returns true if lines at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+//Debug logs msg and the given key value pairs at LevelDebug
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.Log(LevelDebug, msg, kv...)
+}
+
+//Info logs msg and the given key value pairs at LevelInfo
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.Log(LevelInfo, msg, kv...)
+}
+
+//Warn logs msg and the given key value pairs at LevelWarn
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.Log(LevelWarn, msg, kv...)
+}
+
+//Error logs msg and the given key value pairs at LevelError
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.Log(LevelError, msg, kv...)
+}
+
+//Log logs msg and the given key value pairs at level
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	fields = append(fields, "time", time.Now().UTC().Format(time.RFC3339Nano), "level", level.String(), "msg", msg)
+	fields = append(append(fields, l.fields...), kv...)
+
+	buf := new(bytes.Buffer)
+	if l.out.format == FormatText {
+		writeText(buf, fields)
+	} else {
+		writeJSON(buf, fields)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mu.Lock()
+	l.out.w.Write(buf.Bytes())
+	l.out.mu.Unlock()
+}
+
+//value returns a loggable value for v
+func value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case time.Duration:
+		return t.Seconds()
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for idx := 0; idx < len(fields); idx += 2 {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(fmt.Sprint(fields[idx]))
+		buf.Write(k)
+		buf.WriteByte(':')
+
+		var v interface{} = "!MISSING"
+		if idx+1 < len(fields) {
+			v = value(fields[idx+1])
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			b, _ = json.Marshal(fmt.Sprint(v))
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+}
+
+func writeText(buf *bytes.Buffer, fields []interface{}) {
+	for idx := 0; idx < len(fields); idx += 2 {
+		if idx > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(fields[idx]))
+		buf.WriteByte('=')
+
+		var v interface{} = "!MISSING"
+		if idx+1 < len(fields) {
+			v = value(fields[idx+1])
+		}
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+}
+
+type contextKey int
+
+const contextKeyLogger contextKey = 0
+
+//NewContext returns a copy of ctx that carries l
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKeyLogger, l)
+}
+
+//FromContext returns the *Logger carried by ctx, or def if there isn't one
+func FromContext(ctx context.Context, def *Logger) *Logger {
+	if l, ok := ctx.Value(contextKeyLogger).(*Logger); ok {
+		return l
+	}
+	return def
+}
+
+//Writer returns an io.Writer that logs each line written to it, e.g. from the standard log package.
+//Lines prefixed with "WARNING:" are logged at LevelWarn and other lines at level
+func (l *Logger) Writer(level Level) io.Writer {
+	return &lineWriter{l: l, level: level}
+}
+
+type lineWriter struct {
+	l     *Logger
+	level Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		level := w.level
+		if strings.HasPrefix(line, "WARNING:") {
+			level = LevelWarn
+			line = strings.TrimSpace(strings.TrimPrefix(line, "WARNING:"))
+		}
+		w.l.Log(level, line)
+	}
+	return len(p), nil
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"embed"
 	"io/fs"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	_ "embed"
@@ -15,10 +21,18 @@ import (
 	auth "github.com/korylprince/go-ad-auth/v3"
 	"github.com/korylprince/httputil/auth/ad"
 	"github.com/korylprince/httputil/session/memory"
+	shortenerdb "github.com/korylprince/url-shortener-server/v2/db"
 	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+	"github.com/korylprince/url-shortener-server/v2/db/cache"
 	"github.com/korylprince/url-shortener-server/v2/httpapi"
+	"github.com/korylprince/url-shortener-server/v2/logger"
+	"github.com/korylprince/url-shortener-server/v2/unfurl"
+	"github.com/korylprince/url-shortener-server/v2/webhook"
 )
 
+//version is reported by /readyz and set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
 //go:embed client
 var httpEmbed embed.FS
 
@@ -31,9 +45,60 @@ func main() {
 
 	rand.Seed(time.Now().Unix())
 
+	command, args := "serve", []string{}
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	switch command {
+	case "serve":
+		serve(config)
+	case "urls":
+		urlsCommand(config, args)
+	case "users":
+		usersCommand(config, args)
+	case "db":
+		dbCommand(config, args)
+	case "export":
+		exportCommand(config, args)
+	case "import":
+		importCommand(config, args)
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func serve(config *Config) {
+	if err := config.ProcessLDAP(); err != nil {
+		log.Fatalln("Error reading configuration from environment:", err)
+	}
+
+	l := config.Logger()
+
+	//route the standard logger, used by the db layer, through the structured logger
+	log.SetFlags(0)
+	log.SetOutput(l.Writer(logger.LevelInfo))
+
 	db, err := bbolt.New(config.DatabasePath, config.URLIDLength)
 	if err != nil {
-		log.Fatalln("Unable to create database:", err)
+		l.Error("Unable to create database", "error", err)
+		os.Exit(1)
+	}
+
+	db.SetGenerator(config.Generator(), config.IDMaxAttempts)
+	if config.CaseInsensitiveIDs {
+		db.CaseInsensitiveIDs()
+	}
+
+	if config.BatchViews() {
+		db.BatchViews(time.Second * time.Duration(config.ViewFlushInterval))
+	}
+
+	if config.BackupDir != "" {
+		go db.ScheduleSnapshots(config.BackupDir, time.Minute*time.Duration(config.BackupInterval), config.BackupRetain)
 	}
 
 	authConfig := &auth.Config{
@@ -47,14 +112,138 @@ func main() {
 
 	sessionStore := memory.New(time.Minute * time.Duration(config.SessionExpiration))
 
+	var d shortenerdb.DB = db
+	var c *cache.DB
+	if config.CacheSize > 0 {
+		c = cache.New(db, config.CacheSize, time.Second*time.Duration(config.CacheTTL))
+		if config.CaseInsensitiveIDs {
+			c.CaseInsensitiveIDs()
+		}
+		d = c
+	}
+
 	client, _ := fs.Sub(httpEmbed, "client")
-	s := httpapi.NewServer(config.AppTitle, db, auth, config.LDAPAdminGroup, sessionStore, client, os.Stdout)
+	s := httpapi.NewServer(config.AppTitle, d, auth, config.LDAPAdminGroup, sessionStore, client, os.Stdout)
+	s.YOURLSAPI = config.YOURLSAPI
+	s.CaseInsensitiveIDs = config.CaseInsensitiveIDs
+	s.PublicURL = config.PublicBaseURL()
+	s.PreviewExternal = config.PreviewExternal
+	s.InternalDomains = config.Domains()
+	s.Bots = config.Bots()
+	s.TrustedProxies = config.Proxies()
 
-	log.Println("Listening on:", config.ListenAddr)
+	stopUnfurl := make(chan struct{})
+	unfurlStopped := make(chan struct{})
+	if config.Unfurl {
+		s.Unfurl = unfurl.New(d, time.Second*time.Duration(config.UnfurlTimeout), int64(config.UnfurlMaxSize))
+		go func() {
+			defer close(unfurlStopped)
+			s.Unfurl.Run(stopUnfurl)
+		}()
+	} else {
+		close(unfurlStopped)
+	}
+	s.Logger = l
 
+	stopWebhooks := make(chan struct{})
+	webhooksStopped := make(chan struct{})
+	s.Webhooks = webhook.New(db, time.Second*time.Duration(config.WebhookTimeout), config.WebhookMaxAttempts, config.Thresholds())
+	go func() {
+		defer close(webhooksStopped)
+		s.Webhooks.Run(time.Second*time.Duration(config.WebhookScanInterval), stopWebhooks)
+	}()
+	s.Version = version
+	s.SessionExpiration = time.Minute * time.Duration(config.SessionExpiration)
+	s.ReadyTimeout = time.Second * time.Duration(config.ReadyCheckTimeout)
+	if config.ReadyCheckLDAP {
+		s.LDAPCheckAddr = net.JoinHostPort(config.LDAPServer, strconv.Itoa(config.LDAPPort))
+	}
+
+	registerDBMetrics(s.Metrics(), db)
+	if c != nil {
+		registerCacheMetrics(s.Metrics(), c)
+	}
+
+	srv := &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           s.Router(),
+		ReadTimeout:       time.Second * time.Duration(config.ReadTimeout),
+		ReadHeaderTimeout: time.Second * time.Duration(config.ReadHeaderTimeout),
+		WriteTimeout:      time.Second * time.Duration(config.WriteTimeout),
+		IdleTimeout:       time.Second * time.Duration(config.IdleTimeout),
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+
+	var certs *certReloader
 	if config.TLSCert != "" && config.TLSKey != "" {
-		log.Println(http.ListenAndServeTLS(config.ListenAddr, config.TLSCert, config.TLSKey, s.Router()))
+		certs, err = newCertReloader(config.TLSCert, config.TLSKey)
+		if err != nil {
+			l.Error("Unable to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+	}
+
+	//drain requests on SIGINT/SIGTERM and reload the TLS certificate on SIGHUP
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+		for sig := range sigs {
+			if sig == syscall.SIGHUP {
+				if certs == nil {
+					continue
+				}
+				if err := certs.Reload(); err != nil {
+					log.Println("Unable to reload TLS certificate:", err)
+					continue
+				}
+				log.Println("Reloaded TLS certificate")
+				continue
+			}
+
+			log.Printf("Received %v, shutting down\n", sig)
+			signal.Stop(sigs)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(config.ShutdownTimeout))
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Println("Unable to shut down gracefully:", err)
+			}
+			cancel()
+			return
+		}
+	}()
+
+	log.Println("Listening on:", config.ListenAddr)
+
+	if certs != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	//a listener error means the server failed to start or stopped unexpectedly, so exit with an error after cleaning up
+	failed := err != http.ErrServerClosed
+	if failed {
+		l.Error("Server stopped unexpectedly", "error", err)
 	} else {
-		log.Println(http.ListenAndServe(config.ListenAddr, s.Router()))
+		<-stopped
+	}
+
+	close(stopUnfurl)
+	close(stopWebhooks)
+	<-unfurlStopped
+	<-webhooksStopped
+
+	//flush batched views and close the database
+	if err := db.Close(); err != nil {
+		log.Println("Unable to close database:", err)
+	}
+
+	if failed {
+		os.Exit(1)
 	}
 }
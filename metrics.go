@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+
+	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+	"github.com/korylprince/url-shortener-server/v2/db/cache"
+	"github.com/korylprince/url-shortener-server/v2/metrics"
+)
+
+//registerDBMetrics registers database metrics with r
+func registerDBMetrics(r *metrics.Registry, db *bbolt.DB) {
+	r.GaugeFunc("shortener_urls", "Number of short URLs, not including deleted URLs.", func() float64 {
+		count, err := db.Count()
+		if err != nil {
+			log.Println("Unable to count URLs for metrics:", err)
+			return -1
+		}
+		return float64(count)
+	})
+
+	r.GaugeFunc("shortener_db_size_bytes", "Size of the database file in bytes.", func() float64 {
+		size, err := db.Size()
+		if err != nil {
+			log.Println("Unable to get database size for metrics:", err)
+			return -1
+		}
+		return float64(size)
+	})
+
+	r.CounterFunc("shortener_db_read_tx_total", "Number of read transactions started.", func() float64 {
+		return float64(db.Stats().TxN)
+	})
+	r.GaugeFunc("shortener_db_open_read_tx", "Number of open read transactions.", func() float64 {
+		return float64(db.Stats().OpenTxN)
+	})
+	r.GaugeFunc("shortener_db_free_pages", "Number of free pages on the freelist.", func() float64 {
+		return float64(db.Stats().FreePageN)
+	})
+	r.GaugeFunc("shortener_db_pending_pages", "Number of pending pages on the freelist.", func() float64 {
+		return float64(db.Stats().PendingPageN)
+	})
+	r.GaugeFunc("shortener_db_freelist_inuse_bytes", "Bytes used by the freelist.", func() float64 {
+		return float64(db.Stats().FreelistInuse)
+	})
+	r.CounterFunc("shortener_db_page_allocations_total", "Number of page allocations.", func() float64 {
+		stats := db.Stats()
+		return float64(stats.TxStats.GetPageCount())
+	})
+	r.CounterFunc("shortener_db_writes_total", "Number of page writes.", func() float64 {
+		stats := db.Stats()
+		return float64(stats.TxStats.GetWrite())
+	})
+	r.CounterFunc("shortener_db_write_seconds_total", "Time spent writing pages to disk.", func() float64 {
+		stats := db.Stats()
+		return stats.TxStats.GetWriteTime().Seconds()
+	})
+}
+
+//registerCacheMetrics registers redirect cache metrics with r
+func registerCacheMetrics(r *metrics.Registry, c *cache.DB) {
+	r.CounterFunc("shortener_cache_hits_total", "Number of redirect cache hits.", func() float64 {
+		return float64(c.Stats().Hits)
+	})
+	r.CounterFunc("shortener_cache_misses_total", "Number of redirect cache misses.", func() float64 {
+		return float64(c.Stats().Misses)
+	})
+	r.CounterFunc("shortener_cache_evictions_total", "Number of redirect cache evictions.", func() float64 {
+		return float64(c.Stats().Evictions)
+	})
+	r.GaugeFunc("shortener_cache_entries", "Number of entries in the redirect cache.", func() float64 {
+		return float64(c.Stats().Entries)
+	})
+}
@@ -0,0 +1,262 @@
+//Package metrics implements counters, gauges, and histograms exported in the Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//DefaultBuckets are histogram buckets in seconds suitable for HTTP request latencies
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//metric is a metric family that can write itself in the text format
+type metric interface {
+	write(w io.Writer)
+}
+
+//Registry is a set of metrics
+type Registry struct {
+	mu      sync.Mutex
+	names   []string
+	metrics map[string]metric
+}
+
+//NewRegistry returns a new *Registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %s already registered", name))
+	}
+	r.names = append(r.names, name)
+	sort.Strings(r.names)
+	r.metrics[name] = m
+}
+
+//WriteTo writes all metrics to w in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.names))
+	for _, name := range r.names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, m := range metrics {
+		m.write(cw)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+//ServeHTTP implements the http.Handler interface
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help), name, typ)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+//formatLabels returns the label set for the given names and values, e.g. {action="get",code="200"}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	r := strings.NewReplacer("\\", `\\`, "\n", `\n`, `"`, `\"`)
+	pairs := make([]string, len(names))
+	for idx, name := range names {
+		pairs[idx] = fmt.Sprintf(`%s="%s"`, name, r.Replace(values[idx]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+//labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+//vec holds the label values seen by a labeled metric
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	keys   []string
+	values map[string][]string
+}
+
+func (v *vec) check(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := labelKey(values)
+	if _, ok := v.values[key]; !ok {
+		v.keys = append(v.keys, key)
+		sort.Strings(v.keys)
+		v.values[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+//CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	vec
+	counts map[string]float64
+}
+
+//NewCounterVec registers and returns a new *CounterVec
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: vec{name: name, help: help, labels: labels, values: make(map[string][]string)}, counts: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+//Add adds v to the counter with the given label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.check(values)] += v
+}
+
+//Inc increments the counter with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range c.keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, c.values[key]), formatFloat(c.counts[key]))
+	}
+}
+
+//HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+//NewHistogramVec registers and returns a new *HistogramVec with the given upper bounds
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		vec:     vec{name: name, help: help, labels: labels, values: make(map[string][]string)},
+		buckets: buckets,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+	r.register(name, h)
+	return h
+}
+
+//Observe adds an observation of v to the histogram with the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := h.check(values)
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+	for idx, upper := range h.buckets {
+		if v <= upper {
+			counts[idx]++
+		}
+	}
+	h.sums[key] += v
+	h.totals[key]++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range h.keys {
+		values := h.values[key]
+		for idx, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(values, formatFloat(upper))), h.counts[key][idx])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(values, "+Inf")), h.totals[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), h.totals[key])
+	}
+}
+
+//funcMetric is a metric whose value is read when metrics are written
+type funcMetric struct {
+	name string
+	help string
+	typ  string
+	fn   func() float64
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	writeHeader(w, m.name, m.help, m.typ)
+	fmt.Fprintf(w, "%s %s\n", m.name, formatFloat(m.fn()))
+}
+
+//GaugeFunc registers a gauge whose value is returned by fn
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+//CounterFunc registers a counter whose value is returned by fn
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "counter", fn: fn})
+}
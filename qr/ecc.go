@@ -0,0 +1,109 @@
+package qr
+
+//bitBuffer is an append-only sequence of bits
+type bitBuffer struct {
+	bits []bool
+}
+
+//append appends the low n bits of v, most significant first
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.bits = append(b.bits, (v>>uint(i))&1 != 0)
+	}
+}
+
+func (b *bitBuffer) len() int {
+	return len(b.bits)
+}
+
+//bytes packs the bits into bytes. The length must be a multiple of 8
+func (b *bitBuffer) bytes() []byte {
+	buf := make([]byte, len(b.bits)/8)
+	for i, bit := range b.bits {
+		if bit {
+			buf[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return buf
+}
+
+//gfMul multiplies x and y in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+//rsDivisor returns the coefficients of the Reed-Solomon generator polynomial of the given degree,
+//from highest to lowest power, excluding the leading 1
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	var root byte = 1
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+//rsRemainder returns the Reed-Solomon error correction codewords for data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+//addECC splits data into blocks, appends error correction codewords to each, and interleaves them
+func addECC(data []byte, version int, level Level) []byte {
+	blocks := numBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	raw := numRawDataModules(version) / 8
+	numShort := blocks - raw%blocks
+	shortLen := raw / blocks
+
+	divisor := rsDivisor(eccLen)
+	split := make([][]byte, blocks)
+	for i, k := 0, 0; i < blocks; i++ {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		dat := data[k : k+n]
+		k += n
+
+		//short blocks get a placeholder so all blocks are the same length when interleaving
+		block := make([]byte, 0, shortLen+1)
+		block = append(block, dat...)
+		if i < numShort {
+			block = append(block, 0)
+		}
+		split[i] = append(block, rsRemainder(dat, divisor)...)
+	}
+
+	result := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for j, block := range split {
+			if i != shortLen-eccLen || j >= numShort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
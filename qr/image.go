@@ -0,0 +1,94 @@
+package qr
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+//Width returns the width in modules of the code surrounded by a quiet zone margin modules wide.
+//It's the smallest image size in pixels the code can be drawn at
+func (c *Code) Width(margin int) int {
+	return c.Size + margin*2
+}
+
+//Image returns the code as an image size pixels wide, surrounded by a quiet zone at least margin modules wide.
+//Modules are the largest whole number of pixels wide that fits, and the remaining pixels are added to the quiet zone.
+//If size is less than Width(margin), the image is Width(margin) pixels wide so every module gets a pixel
+func (c *Code) Image(size, margin int, fg, bg color.Color) image.Image {
+	width := c.Width(margin)
+	if size < width {
+		size = width
+	}
+	scale := size / width
+	offset := (size - width*scale) / 2
+
+	//module returns the module coordinate for pixel coordinate p
+	module := func(p int) int {
+		if p < offset {
+			return -1
+		}
+		return (p-offset)/scale - margin
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{bg, fg})
+	for py := 0; py < size; py++ {
+		y := module(py)
+		for px := 0; px < size; px++ {
+			if c.Black(module(px), y) {
+				img.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+	return img
+}
+
+//PNG writes the code as a PNG image. See Image
+func (c *Code) PNG(w io.Writer, size, margin int, fg, bg color.Color) error {
+	return png.Encode(w, c.Image(size, margin, fg, bg))
+}
+
+//SVG writes the code as an SVG image size pixels wide, surrounded by a quiet zone margin modules wide
+func (c *Code) SVG(w io.Writer, size, margin int, fg, bg color.Color) error {
+	width := c.Width(margin)
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		size, size, width, width)
+	if _, _, _, a := bg.RGBA(); a != 0 {
+		fmt.Fprintf(b, `<rect width="100%%" height="100%%" %s/>`+"\n", svgFill(bg))
+	}
+
+	//one path with a subpath for each horizontal run of dark modules
+	fmt.Fprintf(b, `<path %s d="`, svgFill(fg))
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			run := 1
+			for c.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(b, "M%d,%dh%dv1h-%dz", x+margin, y+margin, run, run)
+			x += run
+		}
+	}
+	fmt.Fprintf(b, `"/>`+"\n</svg>\n")
+
+	return b.Flush()
+}
+
+//svgFill returns fill attributes for col
+func svgFill(col color.Color) string {
+	n := color.NRGBAModel.Convert(col).(color.NRGBA)
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, n.R, n.G, n.B)
+	if n.A != 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(n.A)/0xff)
+	}
+	return fill
+}
@@ -0,0 +1,421 @@
+//Package qr encodes data as QR codes in byte mode
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//Level is an error correction level
+type Level int
+
+//Error correction levels, recovering roughly 7%, 15%, 25%, and 30% of codewords
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+//ParseLevel returns the Level for the given name (L, M, Q, or H)
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return L, nil
+	case "M":
+		return M, nil
+	case "Q":
+		return Q, nil
+	case "H":
+		return H, nil
+	}
+	return 0, fmt.Errorf("Unknown error correction level: %s", s)
+}
+
+func (l Level) String() string {
+	if l < L || l > H {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return "LMQH"[l : l+1]
+}
+
+//ErrTooLong is returned when data doesn't fit in the largest QR code at the given Level
+var ErrTooLong = errors.New("Data too long")
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+//Code is an encoded QR code
+type Code struct {
+	//Size is the width and height of the code in modules, not including the quiet zone
+	Size int
+
+	Version int
+	Level   Level
+	Mask    int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+//Black returns true if the module at x, y is dark. Coordinates outside the code are light
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+//Encode returns the smallest QR code for data at the given Level
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < L || level > H {
+		return nil, fmt.Errorf("Invalid error correction level: %v", level)
+	}
+
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if 4+countBits(version)+len(data)*8 <= numDataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrTooLong
+	}
+
+	//byte mode indicator, character count, and data
+	b := new(bitBuffer)
+	b.append(0x4, 4)
+	b.append(len(data), countBits(version))
+	for _, d := range data {
+		b.append(int(d), 8)
+	}
+
+	//terminator and padding
+	capacity := numDataCodewords(version, level) * 8
+	t := capacity - b.len()
+	if t > 4 {
+		t = 4
+	}
+	b.append(0, t)
+	b.append(0, (8-b.len()%8)%8)
+	for pad := 0xEC; b.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		b.append(pad, 8)
+	}
+
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	c.drawCodewords(addECC(b.bytes(), version, level))
+
+	//choose the mask with the lowest penalty
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask)
+	}
+
+	c.Mask = best
+	c.applyMask(best)
+	c.drawFormatBits(best)
+
+	return c, nil
+}
+
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+	c := &Code{Size: size, Version: version, Level: level, modules: make([][]bool, size), isFunction: make([][]bool, size)}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+	return c
+}
+
+//countBits returns the width of the byte mode character count for the version
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+//numRawDataModules returns the number of modules available for data and error correction
+func numRawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		n -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+//numDataCodewords returns the number of data codewords for the version and Level
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*numBlocks[level][version]
+}
+
+//alignmentPositions returns the row and column centers of alignment patterns for the version
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	}
+
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	//timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	//finder patterns and separators
+	for _, center := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				c.setFunction(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	//alignment patterns, skipping those overlapping finder patterns
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, cy := range positions {
+		for j, cx := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	//reserve format areas; they're drawn once the mask is chosen
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+//drawFormatBits draws both copies of the format information for the mask
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBits[c.Level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	//first copy, around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	//second copy, split between the top right and bottom left finders
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+//drawVersion draws both copies of the version information for versions 7 and up
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.Version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+//drawCodewords places data in the zigzag pattern over non-function modules
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = (data[i>>3]>>uint(7-(i&7)))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+//applyMask XORs the mask with non-function modules. Applying the same mask twice undoes it
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.isFunction[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+//finderLike is the 1:1:3:1:1 pattern with 4 light modules on one side
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+//penalty scores the code per the QR specification's mask evaluation rules. Lower is better
+func (c *Code) penalty() int {
+	p := 0
+	dark := 0
+
+	for i := 0; i < c.Size; i++ {
+		//runs of 5 or more same colored modules in rows and columns
+		for _, horizontal := range []bool{true, false} {
+			at := func(j int) bool {
+				if horizontal {
+					return c.modules[i][j]
+				}
+				return c.modules[j][i]
+			}
+
+			run := 1
+			for j := 1; j <= c.Size; j++ {
+				if j < c.Size && at(j) == at(j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+
+			//finder-like patterns
+			for j := 0; j+11 <= c.Size; j++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, v := range pattern {
+						if at(j+k) != v {
+							match = false
+							break
+						}
+					}
+					if match {
+						p += 40
+					}
+				}
+			}
+		}
+
+		for j := 0; j < c.Size; j++ {
+			if c.modules[i][j] {
+				dark++
+			}
+
+			//2x2 blocks of the same color
+			if i+1 < c.Size && j+1 < c.Size {
+				v := c.modules[i][j]
+				if v == c.modules[i][j+1] && v == c.modules[i+1][j] && v == c.modules[i+1][j+1] {
+					p += 3
+				}
+			}
+		}
+	}
+
+	//balance of dark and light modules
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	p += k * 10
+
+	return p
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
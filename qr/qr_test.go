@@ -0,0 +1,231 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in    string
+		level Level
+		ok    bool
+	}{
+		{"L", L, true},
+		{"m", M, true},
+		{"Q", Q, true},
+		{"h", H, true},
+		{"", 0, false},
+		{"X", 0, false},
+		{"LL", 0, false},
+	}
+
+	for _, test := range tests {
+		level, err := ParseLevel(test.in)
+		if (err == nil) != test.ok || level != test.level {
+			t.Errorf("ParseLevel(%q): expected %v, %t; got %v, %v", test.in, test.level, test.ok, level, err)
+		}
+	}
+}
+
+func TestEncodeVersion(t *testing.T) {
+	//byte mode capacities from the QR specification
+	tests := []struct {
+		length  int
+		level   Level
+		version int
+	}{
+		{0, L, 1},
+		{17, L, 1},
+		{18, L, 2},
+		{14, M, 1},
+		{15, M, 2},
+		{11, Q, 1},
+		{7, H, 1},
+		{8, H, 2},
+		{230, L, 9},
+		{231, L, 10},
+		{271, L, 10},
+		{272, L, 11},
+		{2953, L, 40},
+		{1273, H, 40},
+	}
+
+	for _, test := range tests {
+		c, err := Encode(bytes.Repeat([]byte("a"), test.length), test.level)
+		if err != nil {
+			t.Errorf("%d bytes at %v: unable to encode: %v", test.length, test.level, err)
+			continue
+		}
+		if c.Version != test.version || c.Size != test.version*4+17 {
+			t.Errorf("%d bytes at %v: expected version %d, got %d with size %d", test.length, test.level, test.version, c.Version, c.Size)
+		}
+	}
+
+	for _, test := range []struct {
+		length int
+		level  Level
+	}{{2954, L}, {1274, H}} {
+		if _, err := Encode(bytes.Repeat([]byte("a"), test.length), test.level); err != ErrTooLong {
+			t.Errorf("%d bytes at %v: expected ErrTooLong, got %v", test.length, test.level, err)
+		}
+	}
+
+	if _, err := Encode([]byte("a"), Level(4)); err == nil {
+		t.Error("Expected invalid level to be refused")
+	}
+}
+
+func TestECC(t *testing.T) {
+	//version 1-M example from the QR specification
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := append(append([]byte(nil), data...), 196, 35, 39, 119, 235, 215, 231, 226, 93, 23)
+
+	if got := addECC(data, 1, M); !bytes.Equal(got, want) {
+		t.Errorf("Expected codewords %v, got %v", want, got)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	//format information strings from the QR specification, indexed by level then mask
+	tests := map[Level][8]string{
+		L: {"111011111000100", "111001011110011", "111110110101010", "111100010011101",
+			"110011000101111", "110001100011000", "110110001000001", "110100101110110"},
+		M: {"101010000010010", "101000100100101", "101111001111100", "101101101001011",
+			"100010111111001", "100000011001110", "100111110010111", "100101010100000"},
+		Q: {"011010101011111", "011000001101000", "011111100110001", "011101000000110",
+			"010010010110100", "010000110000011", "010111011011010", "010101111101101"},
+		H: {"001011010001001", "001001110111110", "001110011100111", "001100111010000",
+			"000011101100010", "000001001010101", "000110100001100", "000100000111011"},
+	}
+
+	for level, masks := range tests {
+		for mask, s := range masks {
+			want, _ := strconv.ParseUint(s, 2, 15)
+			c := newCode(1, level)
+			c.drawFormatBits(mask)
+
+			//first copy, read in the order drawFormatBits writes it
+			var first, second uint64
+			coords := [][2]int{{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8}, {7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8}}
+			for i, xy := range coords {
+				if c.Black(xy[0], xy[1]) {
+					first |= 1 << uint(i)
+				}
+			}
+			for i := 0; i < 15; i++ {
+				x, y := c.Size-1-i, 8
+				if i >= 8 {
+					x, y = 8, c.Size-15+i
+				}
+				if c.Black(x, y) {
+					second |= 1 << uint(i)
+				}
+			}
+
+			if first != want || second != want {
+				t.Errorf("%v mask %d: expected %015b, got %015b and %015b", level, mask, want, first, second)
+			}
+		}
+	}
+}
+
+func TestFinderPatterns(t *testing.T) {
+	c, err := Encode([]byte("https://short.example.com/poster"), M)
+	if err != nil {
+		t.Fatalf("Unable to encode: %v", err)
+	}
+
+	//rows of a finder pattern and its separator, from its corner outward
+	rows := []string{"#######.", "#.....#.", "#.###.#.", "#.###.#.", "#.###.#.", "#.....#.", "#######.", "........"}
+	for _, corner := range [][2]int{{0, 0}, {c.Size - 1, 0}, {0, c.Size - 1}} {
+		dx, dy := 1, 1
+		if corner[0] > 0 {
+			dx = -1
+		}
+		if corner[1] > 0 {
+			dy = -1
+		}
+		for y, row := range rows {
+			for x, want := range row {
+				if black := c.Black(corner[0]+x*dx, corner[1]+y*dy); black != (want == '#') {
+					t.Errorf("Finder at %v: expected module %d, %d to be %c", corner, x, y, want)
+				}
+			}
+		}
+	}
+
+	//dark module
+	if !c.Black(8, c.Size-8) {
+		t.Error("Expected dark module to be dark")
+	}
+}
+
+func TestImage(t *testing.T) {
+	c, err := Encode([]byte("https://short.example.com/poster"), M)
+	if err != nil {
+		t.Fatalf("Unable to encode: %v", err)
+	}
+	width := c.Size + 8
+
+	tests := []struct {
+		size   int
+		margin int
+	}{
+		{width, 4},
+		{width*3 + 2, 4},
+		{256, 4},
+		{c.Size * 8, 0},
+		{256, 1},
+		{2048, 16},
+		{32, 4},
+		{1, 4},
+	}
+
+	for _, test := range tests {
+		img := c.Image(test.size, test.margin, color.Black, color.White)
+
+		//sizes too small for a pixel per module are increased so the code stays scannable
+		want := test.size
+		if w := c.Width(test.margin); want < w {
+			want = w
+		}
+		if b := img.Bounds(); b.Dx() != want || b.Dy() != want {
+			t.Errorf("Size %d: expected %dx%d image, got %dx%d", test.size, want, want, b.Dx(), b.Dy())
+		}
+
+		//the top left corner is in the quiet zone, or the finder pattern without one
+		r, _, _, _ := img.At(0, 0).RGBA()
+		if dark := r == 0; dark != (test.margin == 0) {
+			t.Errorf("Size %d, margin %d: expected top left pixel dark %t", test.size, test.margin, test.margin == 0)
+		}
+	}
+
+	//modules are a whole number of pixels wide, centered in size
+	img := c.Image(width*3+2, 4, color.Black, color.White)
+	for _, p := range []struct {
+		x, y int
+		dark bool
+	}{
+		{1 + 4*3, 1 + 4*3, true},
+		{1 + 4*3 - 1, 1 + 4*3, false},
+		{1 + 11*3 - 1, 1 + 4*3, true},
+		{1 + 11*3, 1 + 4*3, false},
+	} {
+		r, _, _, _ := img.At(p.x, p.y).RGBA()
+		if dark := r == 0; dark != p.dark {
+			t.Errorf("Expected pixel %d, %d dark %t", p.x, p.y, p.dark)
+		}
+	}
+
+	var svg bytes.Buffer
+	if err = c.SVG(&svg, 300, 4, color.Black, color.Transparent); err != nil {
+		t.Fatalf("Unable to write SVG: %v", err)
+	}
+	if s := svg.String(); !strings.Contains(s, `width="300" height="300"`) || strings.Contains(s, "<rect") {
+		t.Errorf("Expected 300 pixel SVG without a background, got %s", s)
+	}
+}
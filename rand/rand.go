@@ -11,7 +11,8 @@ import (
 //Characters is the character-space for random strings
 const Characters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-func randInt(max int) int {
+//Intn returns a random int in [0, max)
+func Intn(max int) int {
 	i, err := crand.Int(crand.Reader, big.NewInt(int64(max)))
 	if err == nil {
 		return int(i.Int64())
@@ -24,10 +25,15 @@ func randInt(max int) int {
 
 //String returns a random string of given length composed of characters from Characters
 func String(length int) string {
+	return StringFrom(Characters, length)
+}
+
+//StringFrom returns a random string of given length composed of characters from chars
+func StringFrom(chars string, length int) string {
 	var s []byte
 
 	for i := 0; i < length; i++ {
-		s = append(s, Characters[randInt(len(Characters))])
+		s = append(s, chars[Intn(len(chars))])
 	}
 
 	return string(s)
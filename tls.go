@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+)
+
+//certReloader serves a TLS certificate that can be reloaded from disk
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+//newCertReloader returns a new *certReloader with the certificate loaded from the given paths,
+//or an error if one occurred
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	c := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//Reload loads the certificate from disk or returns an error if one occurred.
+//The previous certificate is kept if loading fails
+func (c *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return fmt.Errorf("Unable to load certificate %s and key %s: %v", c.certPath, c.keyPath, err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+//GetCertificate implements tls.Config.GetCertificate
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
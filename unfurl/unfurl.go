@@ -0,0 +1,258 @@
+//Package unfurl fetches titles, descriptions, and images from destination pages to unfurl short URLs
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+//queueSize is the number of URLs that can wait to be fetched
+const queueSize = 1000
+
+//maxRedirects is the number of redirects followed when fetching a page
+const maxRedirects = 5
+
+//maxTitleLength and maxDescriptionLength limit the stored metadata, in characters
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+)
+
+//userAgent is sent when fetching pages
+const userAgent = "Mozilla/5.0 (compatible; url-shortener-server; +https://github.com/korylprince/url-shortener-server)"
+
+var (
+	titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaRegexp  = regexp.MustCompile(`(?is)<meta\s([^>]*)>`)
+	attrRegexp  = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	spaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+//sharedNetwork is the carrier-grade NAT range, which isn't covered by net.IP.IsPrivate
+var sharedNetwork = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+//publicIP returns true if ip is a public unicast address. Loopback, private, link-local (including cloud metadata
+//endpoints like 169.254.169.254), shared, unspecified, and multicast addresses aren't public
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedNetwork.Contains(ip))
+}
+
+//Worker fetches metadata for URLs in the background and stores it in the database
+type Worker struct {
+	db      db.DB
+	client  *http.Client
+	maxSize int64
+	queue   chan string
+
+	//allow returns true if pages can be fetched from ip. It's replaced by tests to reach local servers
+	allow func(ip net.IP) bool
+}
+
+//New returns a new *Worker using the given database. Fetches time out after timeout and read at most maxSize bytes.
+//Only public addresses are fetched, checked for each connection so redirects and DNS changes can't reach internal hosts
+func New(d db.DB, timeout time.Duration, maxSize int64) *Worker {
+	w := &Worker{db: d, maxSize: maxSize, queue: make(chan string, queueSize), allow: publicIP}
+
+	//proxies aren't used since they would make the connection instead
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: w.control}).DialContext
+
+	w.client = &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	return w
+}
+
+//control refuses connections to addresses that aren't allowed. It's called with the resolved address
+//before each connection is made
+func (w *Worker) control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("Invalid address %s: %v", address, err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !w.allow(ip) {
+		return fmt.Errorf("Address %s isn't public", host)
+	}
+
+	return nil
+}
+
+//Queue queues the URL with the given id to be fetched. If the queue is full, the URL is skipped
+func (w *Worker) Queue(id string) {
+	select {
+	case w.queue <- id:
+	default:
+		log.Printf("WARNING: Unfurl queue is full; skipping URL \"%s\"\n", id)
+	}
+}
+
+//Run fetches queued URLs until done is closed
+func (w *Worker) Run(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case id := <-w.queue:
+			if err := w.Refresh(id); err != nil {
+				log.Printf("WARNING: Unable to unfurl URL \"%s\": %v\n", id, err)
+			}
+		}
+	}
+}
+
+//Refresh fetches and stores the metadata for the URL with the given id, or returns an error if one occurred.
+//Fetch errors are stored with the metadata instead of being returned
+func (w *Worker) Refresh(id string) error {
+	u, err := w.db.Get(id)
+	if err != nil {
+		return fmt.Errorf("Unable to get URL: %v", err)
+	}
+	if u == nil {
+		return nil
+	}
+
+	unfurl, err := w.Fetch(context.Background(), u.URL)
+	if err != nil {
+		unfurl = &db.Unfurl{URL: u.URL, Error: err.Error()}
+	}
+	now := time.Now()
+	unfurl.Fetched = &now
+
+	if err = w.db.SetUnfurl(id, unfurl); err != nil {
+		return fmt.Errorf("Unable to store metadata: %v", err)
+	}
+
+	return nil
+}
+
+//Fetch returns the metadata for the page at url, or an error if one occurred
+func (w *Worker) Fetch(ctx context.Context, url string) (*db.Unfurl, error) {
+	u, err := neturl.Parse(url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.New("Only http and https URLs can be unfurled")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create request: %v", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch page: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Unable to fetch page: %s", resp.Status)
+	}
+
+	unfurl := &db.Unfurl{URL: url}
+
+	//images can be shown as they are
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "image/") {
+		unfurl.Image = resp.Request.URL.String()
+		return unfurl, nil
+	}
+	if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("Unable to unfurl content type %s", mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, w.maxSize))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read page: %v", err)
+	}
+
+	parse(unfurl, string(body), resp.Request.URL)
+
+	return unfurl, nil
+}
+
+//parse sets the title, description, and image from the page, preferring Open Graph, then Twitter, then standard tags.
+//Relative image URLs are resolved against base
+func parse(unfurl *db.Unfurl, page string, base *neturl.URL) {
+	meta := make(map[string]string)
+	for _, m := range metaRegexp.FindAllStringSubmatch(page, -1) {
+		attrs := make(map[string]string)
+		for _, a := range attrRegexp.FindAllStringSubmatch(m[1], -1) {
+			attrs[strings.ToLower(a[1])] = a[2] + a[3] + a[4]
+		}
+
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+
+		//keep the first value for each key
+		if _, ok := meta[key]; key != "" && !ok {
+			meta[key] = clean(attrs["content"])
+		}
+	}
+
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	var title string
+	if m := titleRegexp.FindStringSubmatch(page); m != nil {
+		title = clean(m[1])
+	}
+
+	unfurl.Title = truncate(first(meta["og:title"], meta["twitter:title"], title), maxTitleLength)
+	unfurl.Description = truncate(first(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLength)
+
+	if image := first(meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"], meta["twitter:image"]); image != "" {
+		if u, err := base.Parse(image); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			unfurl.Image = u.String()
+		}
+	}
+}
+
+//clean unescapes HTML entities and collapses whitespace
+func clean(s string) string {
+	return strings.TrimSpace(spaceRegexp.ReplaceAllString(html.UnescapeString(s), " "))
+}
+
+//truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,219 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"100.64.0.1", false},
+		{"100.128.0.1", true},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+
+	for _, test := range tests {
+		if got := publicIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("Expected publicIP(%s) to be %t", test.ip, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	base, _ := neturl.Parse("https://example.com/blog/post?id=1")
+	long := strings.Repeat("é", maxTitleLength+10)
+
+	tests := []struct {
+		name string
+		page string
+		want db.Unfurl
+	}{
+		{"empty", "", db.Unfurl{}},
+		{"title tag", "<html><head><title>\n  Page &amp; Title  </title></head></html>",
+			db.Unfurl{Title: "Page & Title"}},
+		{"twitter over title", `<title>Page</title><meta name="twitter:title" content="Twitter"><meta name="description" content="Desc">`,
+			db.Unfurl{Title: "Twitter", Description: "Desc"}},
+		{"open graph over twitter", `<title>Page</title>
+			<meta name="twitter:title" content="Twitter"><meta property="og:title" content="OG">
+			<meta name="twitter:description" content="Twitter desc"><meta property="og:description" content="OG desc">
+			<meta name="description" content="Desc">`,
+			db.Unfurl{Title: "OG", Description: "OG desc"}},
+		{"first value kept", `<meta property="og:title" content="First"><meta property="og:title" content="Second">`,
+			db.Unfurl{Title: "First"}},
+		{"attribute forms", `<META Content='Single' Property=og:title><meta content=Bare name=description>`,
+			db.Unfurl{Title: "Single", Description: "Bare"}},
+		{"empty value falls back", `<title>Page</title><meta property="og:title" content="  ">`,
+			db.Unfurl{Title: "Page"}},
+		{"relative image", `<meta property="og:image" content="../img/a.png">`,
+			db.Unfurl{Image: "https://example.com/img/a.png"}},
+		{"root relative image", `<meta name="twitter:image" content="/a.png">`,
+			db.Unfurl{Image: "https://example.com/a.png"}},
+		{"protocol relative image", `<meta property="og:image" content="//cdn.example.net/a.png">`,
+			db.Unfurl{Image: "https://cdn.example.net/a.png"}},
+		{"secure image preferred", `<meta property="og:image" content="http://example.com/a.png"><meta property="og:image:secure_url" content="https://example.com/b.png">`,
+			db.Unfurl{Image: "https://example.com/b.png"}},
+		{"image over twitter", `<meta name="twitter:image" content="/t.png"><meta property="og:image" content="/o.png">`,
+			db.Unfurl{Image: "https://example.com/o.png"}},
+		{"non-http image", `<meta property="og:image" content="javascript:alert(1)">`, db.Unfurl{}},
+		{"long title", "<title>" + long + "</title>",
+			db.Unfurl{Title: strings.Repeat("é", maxTitleLength-1) + "…"}},
+		{"long description", `<meta name="description" content="` + strings.Repeat("a", maxDescriptionLength+1) + `">`,
+			db.Unfurl{Description: strings.Repeat("a", maxDescriptionLength-1) + "…"}},
+		{"exact length", "<title>" + strings.Repeat("a", maxTitleLength) + "</title>",
+			db.Unfurl{Title: strings.Repeat("a", maxTitleLength)}},
+	}
+
+	for _, test := range tests {
+		unfurl := new(db.Unfurl)
+		parse(unfurl, test.page, base)
+		if unfurl.Title != test.want.Title || unfurl.Description != test.want.Description || unfurl.Image != test.want.Image {
+			t.Errorf("%s: expected %q, %q, %q; got %q, %q, %q", test.name, test.want.Title, test.want.Description, test.want.Image,
+				unfurl.Title, unfurl.Description, unfurl.Image)
+		}
+	}
+}
+
+//newTestServer returns a server with pages for testing Fetch
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<title>Page</title><meta property="og:image" content="/a.png">`)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<title>Early</title>"+strings.Repeat(" ", 2048)+`<meta property="og:title" content="Late">`)
+	})
+	mux.HandleFunc("/untyped", func(w http.ResponseWriter, r *http.Request) {
+		//prevent content type sniffing
+		w.Header()["Content-Type"] = nil
+		fmt.Fprint(w, "<title>Untyped</title>")
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title": "JSON"}`)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if n <= 1 {
+			http.Redirect(w, r, "/page", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestFetch(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	w := New(nil, 5*time.Second, 1024)
+	w.allow = func(net.IP) bool { return true }
+
+	tests := []struct {
+		path  string
+		title string
+		image string
+		err   string
+	}{
+		{"/page", "Page", srv.URL + "/a.png", ""},
+		{"/big", "Early", "", ""},
+		{"/untyped", "Untyped", "", ""},
+		{"/json", "", "", "content type application/json"},
+		{"/image", "", srv.URL + "/image", ""},
+		{"/missing", "", "", "404"},
+		{fmt.Sprintf("/redirect/%d", maxRedirects), "Page", srv.URL + "/a.png", ""},
+		{fmt.Sprintf("/redirect/%d", maxRedirects+1), "", "", fmt.Sprintf("stopped after %d redirects", maxRedirects)},
+	}
+
+	for _, test := range tests {
+		unfurl, err := w.Fetch(context.Background(), srv.URL+test.path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error containing %q, got %v", test.path, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unable to fetch: %v", test.path, err)
+			continue
+		}
+		if unfurl.URL != srv.URL+test.path || unfurl.Title != test.title || unfurl.Image != test.image {
+			t.Errorf("%s: expected %s, %q, %q; got %s, %q, %q", test.path, srv.URL+test.path, test.title, test.image,
+				unfurl.URL, unfurl.Title, unfurl.Image)
+		}
+	}
+
+	if _, err := w.Fetch(context.Background(), "ftp://example.com/file"); err == nil {
+		t.Error("Expected non-http URL to be refused")
+	}
+}
+
+func TestFetchPrivate(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	w := New(nil, 5*time.Second, 1024)
+	if _, err := w.Fetch(context.Background(), srv.URL+"/page"); err == nil || !strings.Contains(err.Error(), "isn't public") {
+		t.Errorf("Expected loopback address to be refused, got %v", err)
+	}
+
+	//a second loopback address stands in for an internal host reached by a redirect
+	l, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("Unable to listen on 127.0.0.2: %v", err)
+	}
+	internal := &httptest.Server{Listener: l, Config: &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "<title>Internal</title>")
+	})}}
+	internal.Start()
+	defer internal.Close()
+
+	redirect := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, internal.URL, http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	w.allow = func(ip net.IP) bool { return ip.Equal(net.IPv4(127, 0, 0, 1)) }
+	if _, err = w.Fetch(context.Background(), redirect.URL); err == nil || !strings.Contains(err.Error(), "127.0.0.2 isn't public") {
+		t.Errorf("Expected redirect to refused address to fail, got %v", err)
+	}
+	if _, err = w.Fetch(context.Background(), srv.URL+"/page"); err != nil {
+		t.Errorf("Expected allowed address to be fetched, got %v", err)
+	}
+}
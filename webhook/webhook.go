@@ -0,0 +1,349 @@
+//Package webhook delivers signed JSON payloads for URL events to webhook endpoints
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/rand"
+)
+
+//secretLength is the length of generated webhook secrets
+const secretLength = 32
+
+//batchSize is the maximum number of deliveries attempted at once
+const batchSize = 100
+
+//minBackoff and maxBackoff bound the delay between delivery attempts
+const minBackoff = 10 * time.Second
+const maxBackoff = time.Hour
+
+//pollInterval is how often the queue is checked for due deliveries
+const pollInterval = time.Second
+
+//Request headers
+const (
+	HeaderEvent     = "X-Shortener-Event"
+	HeaderDelivery  = "X-Shortener-Delivery"
+	HeaderSignature = "X-Shortener-Signature"
+)
+
+//Payload is the JSON body sent to webhooks
+type Payload struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	User      string    `json:"user,omitempty"`
+	URL       *db.URL   `json:"url"`
+	Threshold uint64    `json:"threshold,omitempty"`
+}
+
+//Sign returns the signature of body with secret as sent in the X-Shortener-Signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Dispatcher queues events for webhooks and delivers them with retries
+type Dispatcher struct {
+	store       db.WebhookStore
+	client      *http.Client
+	maxAttempts int
+	thresholds  []uint64
+	wake        chan struct{}
+}
+
+//New returns a new *Dispatcher using the given store. Requests time out after timeout and deliveries are
+//abandoned after maxAttempts. View events are sent when a URL's views cross one of thresholds
+func New(store db.WebhookStore, timeout time.Duration, maxAttempts int, thresholds []uint64) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		thresholds:  thresholds,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+//Webhooks returns all webhooks or an error if one occurred
+func (d *Dispatcher) Webhooks() ([]*db.Webhook, error) {
+	return d.store.Webhooks()
+}
+
+//AddWebhook validates and saves a new webhook for the given endpoint and events, generating a secret if empty,
+//or returns an error if one occurred
+func (d *Dispatcher) AddWebhook(endpoint string, events []string, secret, user string) (*db.Webhook, error) {
+	if u, err := neturl.ParseRequestURI(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf(`Invalid webhook url "%s"`, endpoint)
+	}
+
+	for _, e := range events {
+		valid := false
+		for _, v := range db.Events {
+			if e == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf(`Invalid event "%s"`, e)
+		}
+	}
+
+	if secret == "" {
+		secret = rand.String(secretLength)
+	}
+
+	created := time.Now()
+	hook := &db.Webhook{URL: endpoint, Secret: secret, Events: events, Created: &created, CreatedBy: user}
+	if err := d.store.PutWebhook(hook); err != nil {
+		return nil, err
+	}
+
+	d.signal()
+
+	return hook, nil
+}
+
+//DeleteWebhook deletes the webhook with the given id or returns an error if one occurred
+func (d *Dispatcher) DeleteWebhook(id string) error {
+	return d.store.DeleteWebhook(id)
+}
+
+//Deliveries returns up to limit queued and logged deliveries or an error if one occurred
+func (d *Dispatcher) Deliveries(limit int) ([]*db.Delivery, error) {
+	return d.store.Deliveries(limit)
+}
+
+//deliveries returns deliveries of the event for each subscribed hook.
+//Hooks aren't sent expirations that happened before they were created
+func deliveries(hooks []*db.Webhook, p *Payload) ([]*db.Delivery, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode payload: %v", err)
+	}
+
+	var ds []*db.Delivery
+	for _, hook := range hooks {
+		if !hook.Subscribed(p.Event) {
+			continue
+		}
+		if p.Event == db.EventExpired && hook.Created != nil && p.URL.Expires != nil && hook.Created.After(*(p.URL.Expires)) {
+			continue
+		}
+		ds = append(ds, &db.Delivery{
+			WebhookID:   hook.ID,
+			Event:       p.Event,
+			Payload:     body,
+			Status:      db.DeliveryPending,
+			Created:     p.Time,
+			NextAttempt: p.Time,
+		})
+	}
+
+	return ds, nil
+}
+
+//Notify queues the event for url, caused by user, for delivery to subscribed webhooks
+//or returns an error if one occurred
+func (d *Dispatcher) Notify(event string, url *db.URL, user string) error {
+	hooks, err := d.store.Webhooks()
+	if err != nil {
+		return fmt.Errorf("Unable to get webhooks: %v", err)
+	}
+
+	ds, err := deliveries(hooks, &Payload{Event: event, Time: time.Now(), User: user, URL: url})
+	if err != nil {
+		return err
+	}
+
+	if err = d.store.Enqueue(ds...); err != nil {
+		return fmt.Errorf("Unable to queue deliveries: %v", err)
+	}
+
+	d.signal()
+
+	return nil
+}
+
+//signal wakes Run without blocking
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+//configured returns true if any webhooks exist. Errors are logged and treated as configured so Run reports them
+func (d *Dispatcher) configured() bool {
+	hooks, err := d.store.Webhooks()
+	if err != nil {
+		log.Println("WARNING: Unable to get webhooks:", err)
+		return true
+	}
+	return len(hooks) > 0
+}
+
+//Scan queues events for URLs that have expired or crossed a view threshold or returns an error if one occurred
+func (d *Dispatcher) Scan() error {
+	hooks, err := d.store.Webhooks()
+	if err != nil {
+		return fmt.Errorf("Unable to get webhooks: %v", err)
+	}
+
+	now := time.Now()
+	return d.store.ScanEvents(now, d.thresholds, func(event string, url *db.URL, threshold uint64) ([]*db.Delivery, error) {
+		return deliveries(hooks, &Payload{Event: event, Time: now, URL: url, Threshold: threshold})
+	})
+}
+
+//backoff returns the delay before the next attempt after the given number of attempts
+func backoff(attempts int) time.Duration {
+	b := minBackoff
+	for i := 1; i < attempts && b < maxBackoff; i++ {
+		b *= 2
+	}
+	if b > maxBackoff {
+		b = maxBackoff
+	}
+	return b
+}
+
+//send posts the delivery to hook
+func (d *Dispatcher) send(hook *db.Webhook, delivery *db.Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return fmt.Errorf("Unable to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+//deliver attempts the delivery and updates the queue
+func (d *Dispatcher) deliver(hooks map[string]*db.Webhook, delivery *db.Delivery) error {
+	delivery.Attempts++
+
+	err := errors.New("Webhook was deleted")
+	hook, ok := hooks[delivery.WebhookID]
+	if ok {
+		err = d.send(hook, delivery)
+	}
+
+	now := time.Now()
+	if err == nil {
+		delivery.Status = db.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.Finished = &now
+		return d.store.Finish(delivery)
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts || !ok {
+		delivery.Status = db.DeliveryFailed
+		delivery.Finished = &now
+		log.Printf("WARNING: Webhook delivery %d to %s failed after %d attempts: %v\n", delivery.ID, delivery.WebhookID, delivery.Attempts, err)
+		return d.store.Finish(delivery)
+	}
+
+	delivery.NextAttempt = now.Add(backoff(delivery.Attempts))
+	return d.store.Requeue(delivery)
+}
+
+//deliverDue attempts all due deliveries, stopping early if done is closed
+func (d *Dispatcher) deliverDue(done <-chan struct{}) error {
+	for {
+		due, err := d.store.Due(time.Now(), batchSize)
+		if err != nil {
+			return fmt.Errorf("Unable to get due deliveries: %v", err)
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		list, err := d.store.Webhooks()
+		if err != nil {
+			return fmt.Errorf("Unable to get webhooks: %v", err)
+		}
+		hooks := make(map[string]*db.Webhook, len(list))
+		for _, hook := range list {
+			hooks[hook.ID] = hook
+		}
+
+		for _, delivery := range due {
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+			if err = d.deliver(hooks, delivery); err != nil {
+				return fmt.Errorf("Unable to update delivery %d: %v", delivery.ID, err)
+			}
+		}
+
+		if len(due) < batchSize {
+			return nil
+		}
+	}
+}
+
+//Run delivers queued events and scans for expired URLs and view thresholds every scanInterval
+//until done is closed. Run waits for a webhook to be added if none exist
+func (d *Dispatcher) Run(scanInterval time.Duration, done <-chan struct{}) {
+	for !d.configured() {
+		select {
+		case <-done:
+			return
+		case <-d.wake:
+		}
+	}
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	scan := time.NewTicker(scanInterval)
+	defer scan.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-scan.C:
+			if err := d.Scan(); err != nil {
+				log.Println("WARNING: Unable to scan for webhook events:", err)
+			}
+		case <-poll.C:
+		case <-d.wake:
+		}
+
+		if err := d.deliverDue(done); err != nil {
+			log.Println("WARNING: Unable to deliver webhooks:", err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/korylprince/url-shortener-server/v2/db"
+	"github.com/korylprince/url-shortener-server/v2/db/bbolt"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, minBackoff},
+		{1, minBackoff},
+		{2, 2 * minBackoff},
+		{3, 4 * minBackoff},
+		{5, 16 * minBackoff},
+		{9, 256 * minBackoff},
+		{10, maxBackoff},
+		{100, maxBackoff},
+	}
+
+	for _, test := range tests {
+		if b := backoff(test.attempts); b != test.want {
+			t.Errorf("Expected backoff after %d attempts to be %v, got %v", test.attempts, test.want, b)
+		}
+	}
+}
+
+//newStore returns a new webhook store in a temporary database
+func newStore(t *testing.T) *bbolt.DB {
+	t.Helper()
+	d, err := bbolt.New(filepath.Join(t.TempDir(), "urls.db"), 6)
+	if err != nil {
+		t.Fatalf("Unable to create database: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestDeliverRetry(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		status     int
+		attempts   int
+		deleted    bool
+		wantStatus string
+		wantQueued bool
+	}{
+		{"delivered", http.StatusNoContent, 0, false, db.DeliveryDelivered, false},
+		{"first failure is retried", http.StatusInternalServerError, 0, false, db.DeliveryPending, true},
+		{"later failure is retried", http.StatusBadGateway, 1, false, db.DeliveryPending, true},
+		{"last attempt fails", http.StatusInternalServerError, 2, false, db.DeliveryFailed, false},
+		{"retry succeeds", http.StatusOK, 2, false, db.DeliveryDelivered, false},
+		{"deleted webhook fails", http.StatusOK, 0, true, db.DeliveryFailed, false},
+	}
+
+	for _, test := range tests {
+		store := newStore(t)
+		d := New(store, time.Second, 3, nil)
+		hook, err := d.AddWebhook(srv.URL, nil, "", "alice")
+		if err != nil {
+			t.Fatalf("%s: unable to add webhook: %v", test.name, err)
+		}
+
+		delivery := &db.Delivery{WebhookID: hook.ID, Event: db.EventCreated, Payload: []byte("{}"),
+			Status: db.DeliveryPending, Attempts: test.attempts, Created: time.Now(), NextAttempt: time.Now()}
+		if err = store.Enqueue(delivery); err != nil {
+			t.Fatalf("%s: unable to queue delivery: %v", test.name, err)
+		}
+
+		hooks := map[string]*db.Webhook{hook.ID: hook}
+		if test.deleted {
+			hooks = nil
+		}
+		status = test.status
+		start := time.Now()
+		if err = d.deliver(hooks, delivery); err != nil {
+			t.Fatalf("%s: unable to deliver: %v", test.name, err)
+		}
+
+		if delivery.Status != test.wantStatus || delivery.Attempts != test.attempts+1 {
+			t.Errorf("%s: expected status %s after %d attempts, got %s after %d",
+				test.name, test.wantStatus, test.attempts+1, delivery.Status, delivery.Attempts)
+		}
+
+		due, err := store.Due(time.Now().Add(maxBackoff), batchSize)
+		if err != nil {
+			t.Fatalf("%s: unable to get queue: %v", test.name, err)
+		}
+		if queued := len(due) == 1; queued != test.wantQueued {
+			t.Errorf("%s: expected queued %t, got %t", test.name, test.wantQueued, queued)
+		}
+
+		if test.wantQueued {
+			if next := delivery.NextAttempt.Sub(start); next < backoff(delivery.Attempts) || next > backoff(delivery.Attempts)+time.Minute {
+				t.Errorf("%s: expected next attempt in %v, got %v", test.name, backoff(delivery.Attempts), next)
+			}
+			if due, _ = store.Due(time.Now(), batchSize); len(due) != 0 {
+				t.Errorf("%s: expected delivery not to be due before backoff", test.name)
+			}
+		} else if delivery.Finished == nil {
+			t.Errorf("%s: expected finished delivery", test.name)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	store := newStore(t)
+	d := New(store, time.Second, 3, []uint64{10, 100})
+
+	expired := time.Now().Add(-time.Hour)
+	urls := []*db.URL{
+		{ID: "expired", URL: "https://example.com/a", User: "alice", Expires: &expired},
+		{ID: "viewed", URL: "https://example.com/b", User: "alice"},
+	}
+	for _, url := range urls {
+		if _, err := store.Put(url, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 15; i++ {
+		if err := store.CountView("viewed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hook, err := d.AddWebhook("https://example.com/hook", nil, "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := func() map[string]int {
+		due, err := store.Due(time.Now(), batchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := make(map[string]int)
+		for _, delivery := range due {
+			if delivery.WebhookID != hook.ID {
+				t.Errorf("Expected delivery to %s, got %s", hook.ID, delivery.WebhookID)
+			}
+			events[delivery.Event]++
+		}
+		return events
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = d.Scan(); err != nil {
+			t.Fatalf("Unable to scan: %v", err)
+		}
+		//expired before the webhook was created
+		if events := queued(); len(events) != 1 || events[db.EventViews] != 1 {
+			t.Errorf("Scan %d: expected 1 views event, got %v", i+1, events)
+		}
+	}
+
+	url, err := store.Get("expired")
+	if err != nil || url == nil {
+		t.Fatalf("Unable to get URL: %v", err)
+	}
+	expired = hook.Created.Add(time.Microsecond)
+	url.Expires = &expired
+	if err = store.Update("expired", url, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Scan(); err != nil {
+		t.Fatalf("Unable to scan: %v", err)
+	}
+	if events := queued(); len(events) != 2 || events[db.EventExpired] != 1 {
+		t.Errorf("Expected expired event after the webhook was created, got %v", events)
+	}
+}